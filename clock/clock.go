@@ -16,11 +16,27 @@ type Clock struct {
 	pause     chan bool
 	isDone    bool
 	done      chan bool
-	dl        sync.Mutex
+	dl        sync.Mutex // Guards running, isPaused, isDone and stopped
+	calls     chan func()
+	stopped   chan bool
 }
 
 func NewClock(frequency uint64, cpu chan int, ppu chan int) *Clock {
-	return &Clock{frequency, cpu, ppu, 0, false, false, make(chan bool), true, make(chan bool), sync.Mutex{}}
+	return &Clock{frequency, cpu, ppu, 0, false, false, make(chan bool, 1), true, make(chan bool), sync.Mutex{}, make(chan func()), nil}
+}
+
+func (c *Clock) state() (done, paused bool) {
+	c.dl.Lock()
+	defer c.dl.Unlock()
+	return c.isDone, c.isPaused
+}
+
+// wake nudges a paused clock loop without blocking if it's busy
+func (c *Clock) wake(step bool) {
+	select {
+	case c.pause <- step:
+	default:
+	}
 }
 
 func waitFor(ch chan bool) {
@@ -33,22 +49,23 @@ func waitFor(ch chan bool) {
 }
 
 func (c *Clock) execute() {
-	c.isDone = false
 	startTime := time.Now()
 	interval := time.Second / time.Duration(c.frequency)
 	fmt.Printf("Started Clock at %v with interval %v (%vMHz)\n", startTime, interval, float64(c.frequency)/1000000.0)
 
 	for {
-		if c.isDone {
+		c.runCalls()
+		if done, paused := c.state(); done {
 			break
-		} else if c.isPaused {
-			<-c.pause
+		} else if paused {
+			c.waitPaused()
 		}
 
 		c.cpu <- 0
 		cycles := <-c.cpu
 		totalCycles := cycles * 3
-		for i := 0; i < totalCycles; i++ {
+		// The NSF player runs without a PPU
+		for i := 0; c.ppu != nil && i < totalCycles; i++ {
 			c.ppu <- 0
 			<-c.ppu
 		}
@@ -63,40 +80,108 @@ func (c *Clock) execute() {
 	}
 	mhz := float64(c.tick/uint64(seconds)) / 1000000.0
 	fmt.Printf("Stopped Clock at %v after %v ticks for %vMHz\n", endTime, c.tick, mhz)
+	c.dl.Lock()
 	c.running = false
+	close(c.stopped)
+	c.dl.Unlock()
 	c.done <- true
 }
 
+// runCalls runs whatever is waiting on Call
+func (c *Clock) runCalls() {
+	for {
+		select {
+		case f := <-c.calls:
+			f()
+		default:
+			return
+		}
+	}
+}
+
+// waitPaused blocks until the clock is stepped or resumed, still taking calls
+// in the meantime
+func (c *Clock) waitPaused() {
+	for {
+		select {
+		case <-c.pause:
+			return
+		case f := <-c.calls:
+			f()
+		}
+	}
+}
+
+// Call runs f on the clock goroutine between instructions, while the CPU and
+// PPU are waiting on it. Anything that reads emulated memory from another
+// goroutine goes through here. If the clock isn't running f is called
+// directly.
+func (c *Clock) Call(f func()) {
+	c.dl.Lock()
+	running, stopped := c.running, c.stopped
+	c.dl.Unlock()
+
+	if !running {
+		f()
+		return
+	}
+
+	done := make(chan bool)
+	select {
+	case c.calls <- func() { f(); close(done) }:
+		<-done
+	case <-stopped:
+		f()
+	}
+}
+
 func (c *Clock) Run() {
+	c.dl.Lock()
+	defer c.dl.Unlock()
 	if c.running {
 		return
 	}
 
 	c.running = true
+	c.isDone = false
+	c.stopped = make(chan bool)
 	go c.execute()
 }
 
 func (c *Clock) Pause() {
+	c.dl.Lock()
+	defer c.dl.Unlock()
 	c.isPaused = true
+
+	// Don't let a step or resume from before the pause run an instruction
+	select {
+	case <-c.pause:
+	default:
+	}
 }
 
 func (c *Clock) Resume() {
+	c.dl.Lock()
 	c.isPaused = false
-	c.pause <- false
+	c.dl.Unlock()
+	c.wake(false)
 }
 
 func (c *Clock) Step() {
-	if c.isPaused {
-		c.pause <- true
+	if _, paused := c.state(); paused {
+		c.wake(true)
 	}
 }
 
 func (c *Clock) Stop() {
-	if c.running {
-		c.isDone = true
-		if c.isPaused {
-			c.pause <- true
-		}
+	// Only the first Stop waits for the loop to finish
+	c.dl.Lock()
+	running := c.running && !c.isDone
+	c.isDone = true
+	c.dl.Unlock()
+
+	if running {
+		c.wake(true)
 		<-c.done
 	}
 }
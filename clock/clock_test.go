@@ -0,0 +1,35 @@
+package clock
+
+import "testing"
+
+// cpu answers every tick with a one cycle instruction
+func cpu() chan int {
+	ch := make(chan int)
+	go func() {
+		for {
+			<-ch
+			ch <- 1
+		}
+	}()
+	return ch
+}
+
+func TestCallRunsOnClock(t *testing.T) {
+	c := NewClock(1000000, cpu(), nil)
+	c.Run()
+
+	c.Call(func() {})
+
+	// A paused clock still takes calls
+	c.Pause()
+	c.Call(func() {})
+	c.Resume()
+
+	c.Stop()
+
+	called := false
+	c.Call(func() { called = true })
+	if !called {
+		t.Errorf("Call after Stop didn't run")
+	}
+}
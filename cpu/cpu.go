@@ -27,6 +27,14 @@ const (
 	AddressAddress
 )
 
+const (
+	VectorNMI   uint16 = 0xFFFA
+	VectorReset uint16 = 0xFFFC
+	VectorIRQ   uint16 = 0xFFFE
+)
+
+const interruptCycles = 7
+
 type CPU struct {
 	nes *nes.NES `json:"-"`
 	Registers
@@ -40,19 +48,30 @@ type CPU struct {
 	nesLog           *bufio.Reader `json:"-"`
 	Sync             chan int      `json:"-"`
 	exit             chan bool     `json:"-"`
+
+	nmiLine    bool          `json:"-"`
+	nmiPending bool          `json:"-"`
+	irqLine    nes.IRQSource `json:"-"`
 }
 
 func NewCPU(n *nes.NES, exit chan bool, log, nesLog *os.File) *CPU {
-	return &CPU{
+	c := &CPU{
 		nes:    n,
 		cpuLog: log,
 		nesLog: bufio.NewReader(nesLog),
 		Sync:   make(chan int),
 		exit:   exit,
 	}
+
+	n.Interrupts = c
+
+	return c
 }
 
 func (c *CPU) loadOpcodes() {
+	// Everything is decoded from scratch, so earlier bank switches don't matter
+	c.nes.Remapped()
+
 	c.Opcodes = make([]*Opcode, len(c.nes.Memory))
 	c.Executers = make([]Executer, len(c.nes.Memory))
 	for i, _ := range c.nes.Memory {
@@ -76,6 +95,7 @@ func (c *CPU) execute() {
 		<-c.Sync
 		if c.nintendulatorLog {
 			c.nes.Debug = true
+			c.decode(c.PC)
 			op := c.Opcodes[c.PC]
 			disassembly := fmt.Sprintf("%v %v", op.Disassemble(), op.GetValueAt(c))
 			ppuc := (cs * 3) % 341
@@ -109,6 +129,10 @@ func (c *CPU) execute() {
 		cycles := c.Execute()
 		cs += cycles
 
+		if counter, ok := c.nes.Mapper.(nes.CPUCycleCounter); ok {
+			counter.CPUCycles(cycles)
+		}
+
 		c.Sync <- cycles
 
 	}
@@ -119,12 +143,54 @@ func (c *CPU) Run() {
 }
 
 func (c *CPU) Execute() int {
+	if c.nmiPending {
+		c.nmiPending = false
+		return c.interrupt(VectorNMI)
+	}
+
+	if c.irqLine != 0 && !c.Interrupt {
+		return c.interrupt(VectorIRQ)
+	}
+
+	c.decode(c.PC)
 	cycles, pc := c.Executers[c.PC](c)
 	c.PC = pc
 
 	return cycles
 }
 
+// SetNMI drives the /NMI input. NMI is edge triggered, so only the transition
+// from inactive to active queues an interrupt.
+func (c *CPU) SetNMI(active bool) {
+	if active && !c.nmiLine {
+		c.nmiPending = true
+	}
+	c.nmiLine = active
+}
+
+// SetIRQ drives the /IRQ input for a single source. IRQ is level triggered and
+// is serviced for as long as any source holds it and interrupts are enabled.
+func (c *CPU) SetIRQ(source nes.IRQSource, active bool) {
+	if active {
+		c.irqLine |= source
+	} else {
+		c.irqLine &^= source
+	}
+}
+
+func (c *CPU) interrupt(vector uint16) int {
+	c.Push(byte(c.PC >> 8))
+	c.Push(byte(c.PC))
+	c.Push(c.Status() &^ 16) // Break is only pushed set by BRK/PHP
+	c.Interrupt = true
+
+	lsb := c.nes.Get(vector)
+	msb := c.nes.Get(vector + 1)
+	c.PC = uint16(lsb) | (uint16(msb) << 8)
+
+	return interruptCycles
+}
+
 func (c *CPU) Push(val byte) {
 	*c.nes.Stack[c.SP] = val
 	c.SP--
@@ -136,18 +202,22 @@ func (c *CPU) Pop() byte {
 }
 
 func (c *CPU) PowerUp() {
-	c.PC = uint16(*c.nes.Memory[0xFFFC]) | (uint16(*c.nes.Memory[0xFFFD]) << 8)
+	c.PC = uint16(c.nes.Get(VectorReset)) | (uint16(c.nes.Get(VectorReset+1)) << 8)
 	c.A = 0
 	c.X = 0
 	c.Y = 0
 	c.SP = 0xFD
 	c.Interrupt = true
+	c.nmiLine = false
+	c.nmiPending = false
+	c.irqLine = 0
 }
 
 func (c *CPU) Reset() {
-	c.PC = uint16(*c.nes.Memory[0xFFFC]) | (uint16(*c.nes.Memory[0xFFFD]) << 8)
+	c.PC = uint16(c.nes.Get(VectorReset)) | (uint16(c.nes.Get(VectorReset+1)) << 8)
 	c.SP -= 3
 	c.Interrupt = true
+	c.nmiPending = false
 	*c.nes.Memory[0x4015] = 0x00
 }
 
@@ -288,16 +358,42 @@ func getSetter(addressMode int, address, instructionLength, operand uint16) Sett
 	}
 }
 
+// decode lazily decodes the instruction at address if it was invalidated.
+// Banks can be switched by more than CPU writes, like reads with side effects
+// or the debugger, so anything remapped since the last instruction is
+// invalidated first.
+func (c *CPU) decode(address uint16) {
+	if start, end, ok := c.nes.Remapped(); ok {
+		c.invalidate(start, end)
+	}
+
+	if c.Executers[address] != nil {
+		return
+	}
+
+	op := NewOpcode(c.nes.Memory, address)
+	if op == nil {
+		return
+	}
+	c.Opcodes[address] = op
+	c.Executers[address] = op.Executer()
+}
+
 func (c *CPU) invalidateExecutor(address uint16) {
-	start := address - 2
+	c.invalidate(int(address), int(address)+1)
+}
+
+// invalidate drops the decoded instructions in [start, end)
+func (c *CPU) invalidate(start, end int) {
+	// Instructions that begin up to two bytes before the range can run into it
+	start -= 2
 	if start < 0 {
 		start = 0
 	}
 
-	for i := start; i <= address; i++ {
-		op := NewOpcode(c.nes.Memory, i)
-		c.Opcodes[i] = op
-		c.Executers[i] = op.Executer()
+	for i := start; i < end; i++ {
+		c.Opcodes[i] = nil
+		c.Executers[i] = nil
 	}
 }
 
@@ -0,0 +1,104 @@
+package cpu
+
+import (
+	"testing"
+
+	"github.com/evandigby/nesgo/nes"
+)
+
+func program(code ...byte) []*byte {
+	p := make([]*byte, len(code))
+	for i := range code {
+		p[i] = &code[i]
+	}
+	return p
+}
+
+func newTestCPU(n *nes.NES) *CPU {
+	c := NewCPU(n, nil, nil, nil)
+	c.loadOpcodes()
+	return c
+}
+
+// A bank switch that doesn't come from a CPU write, like an NSF track change
+// triggered by a read, still has to throw away the old bank's instructions.
+func TestRemapOutsideWriteInvalidatesDecodedCode(t *testing.T) {
+	n := nes.NewNES()
+	n.MapPRG(0x8000, program(0xA9, 0x01)) // LDA #$01
+	c := newTestCPU(n)
+
+	c.PC = 0x8000
+	c.Execute()
+	if c.A != 0x01 {
+		t.Fatalf("A = $%02X, want $01", c.A)
+	}
+
+	n.MapPRG(0x8000, program(0xA9, 0x02)) // LDA #$02
+	c.PC = 0x8000
+	c.Execute()
+	if c.A != 0x02 {
+		t.Fatalf("A = $%02X after remap, want $02", c.A)
+	}
+}
+
+// readRemapper switches in a new bank at $8000 when $4180 is read, the way
+// the NSF player starts a track
+type readRemapper struct {
+	n    *nes.NES
+	bank []*byte
+}
+
+func (m *readRemapper) Attach(n *nes.NES)                   { m.n = n }
+func (m *readRemapper) Write(address uint16, value byte)    {}
+func (m *readRemapper) WriteCHR(address uint16, value byte) {}
+
+func (m *readRemapper) Read(address uint16, debug bool) byte {
+	if address == 0x4180 && !debug {
+		m.n.MapPRG(0x8000, m.bank)
+	}
+	return *m.n.Memory[address]
+}
+
+func TestRemapOnReadInvalidatesDecodedCode(t *testing.T) {
+	n := nes.NewNES()
+	n.Insert(&readRemapper{bank: program(
+		0xAD, 0x80, 0x41, // LDA $4180
+		0xA9, 0x02, // LDA #$02
+	)})
+	n.MapPRG(0x8000, program(
+		0xAD, 0x80, 0x41, // LDA $4180
+		0xA9, 0x01, // LDA #$01
+	))
+	c := newTestCPU(n)
+
+	c.PC = 0x8000
+	c.Execute()
+	c.Execute()
+	if c.A != 0x02 {
+		t.Fatalf("A = $%02X, want $02 from the bank switched in by the read", c.A)
+	}
+}
+
+func TestWriteInvalidatesDecodedCode(t *testing.T) {
+	n := nes.NewNES()
+	code := []byte{
+		0xA9, 0x05, // LDA #$05
+		0x8D, 0x09, 0x02, // STA $0209, the operand of the LDX below
+		0xEA,       // NOP
+		0xEA,       // NOP
+		0xEA,       // NOP
+		0xA2, 0x01, // LDX #$01
+	}
+	for i, b := range code {
+		*n.Memory[0x0200+i] = b
+	}
+	c := newTestCPU(n)
+
+	c.PC = 0x0200
+	for i := 0; i < 6; i++ {
+		c.Execute()
+	}
+	if c.X != 0x05 {
+		t.Fatalf("X = $%02X, want the modified operand $05", c.X)
+	}
+}
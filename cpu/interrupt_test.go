@@ -0,0 +1,133 @@
+package cpu
+
+import (
+	"testing"
+
+	"github.com/evandigby/nesgo/nes"
+)
+
+// newInterruptCPU returns a CPU running NOPs at $8000 with interrupts
+// enabled, its NMI handler at $9000 and IRQ handler at $A000
+func newInterruptCPU() (*nes.NES, *CPU) {
+	n := nes.NewNES()
+	for _, address := range []int{0x8000, 0x9000, 0xA000} {
+		for i := 0; i < 0x10; i++ {
+			*n.Memory[address+i] = 0xEA // NOP
+		}
+	}
+	*n.Memory[VectorNMI], *n.Memory[VectorNMI+1] = 0x00, 0x90
+	*n.Memory[VectorIRQ], *n.Memory[VectorIRQ+1] = 0x00, 0xA0
+
+	c := newTestCPU(n)
+	c.PC = 0x8000
+	c.SP = 0xFD
+	c.Interrupt = false
+	return n, c
+}
+
+func TestNMIIsEdgeTriggered(t *testing.T) {
+	_, c := newInterruptCPU()
+	c.Interrupt = true // NMI can't be masked
+
+	c.SetNMI(true)
+	if cycles := c.Execute(); c.PC != 0x9000 || cycles != 7 {
+		t.Fatalf("NMI went to $%04X in %v cycles, want $9000 in 7", c.PC, cycles)
+	}
+
+	// Holding the line doesn't fire it again
+	c.SetNMI(true)
+	c.Execute()
+	if c.PC != 0x9001 {
+		t.Fatalf("PC = $%04X with /NMI held, want $9001", c.PC)
+	}
+
+	c.SetNMI(false)
+	c.SetNMI(true)
+	c.Execute()
+	if c.PC != 0x9000 {
+		t.Errorf("PC = $%04X after a new NMI edge, want $9000", c.PC)
+	}
+}
+
+func TestInterruptPushesPCAndStatus(t *testing.T) {
+	n, c := newInterruptCPU()
+	c.PC = 0x8005
+	c.Carry = true
+
+	c.SetNMI(true)
+	c.Execute()
+
+	if c.SP != 0xFA {
+		t.Fatalf("SP = $%02X, want $FA after pushing three bytes", c.SP)
+	}
+	if pc := uint16(*n.Memory[0x01FD])<<8 | uint16(*n.Memory[0x01FC]); pc != 0x8005 {
+		t.Errorf("Pushed PC $%04X, want $8005", pc)
+	}
+	status := *n.Memory[0x01FB]
+	if status&0x10 != 0 || status&0x20 == 0 || status&0x01 == 0 || status&0x04 != 0 {
+		t.Errorf("Pushed status %08b, want B clear, bit 5 set, C set and I clear", status)
+	}
+	if !c.Interrupt {
+		t.Errorf("I flag clear after the interrupt")
+	}
+}
+
+func TestIRQIsLevelTriggeredAndMasked(t *testing.T) {
+	_, c := newInterruptCPU()
+
+	c.Interrupt = true
+	c.SetIRQ(nes.IRQMapper, true)
+	c.Execute()
+	if c.PC != 0x8001 {
+		t.Fatalf("IRQ taken with I set, PC = $%04X", c.PC)
+	}
+
+	c.Interrupt = false
+	if cycles := c.Execute(); c.PC != 0xA000 || cycles != 7 {
+		t.Fatalf("IRQ went to $%04X in %v cycles, want $A000 in 7", c.PC, cycles)
+	}
+
+	// The handler runs with I set, and the IRQ fires again once it's clear
+	// because the line is still held
+	c.Execute()
+	if c.PC != 0xA001 {
+		t.Fatalf("IRQ retaken inside its handler, PC = $%04X", c.PC)
+	}
+	c.Interrupt = false
+	c.Execute()
+	if c.PC != 0xA000 {
+		t.Errorf("Held IRQ not retaken, PC = $%04X", c.PC)
+	}
+}
+
+func TestIRQSourcesShareTheLine(t *testing.T) {
+	_, c := newInterruptCPU()
+	other := nes.IRQMapper << 1
+
+	c.SetIRQ(nes.IRQMapper, true)
+	c.SetIRQ(other, true)
+	c.SetIRQ(nes.IRQMapper, false)
+	c.Execute()
+	if c.PC != 0xA000 {
+		t.Fatalf("IRQ released while another source held it, PC = $%04X", c.PC)
+	}
+
+	c.SetIRQ(other, false)
+	c.Interrupt = false
+	c.PC = 0x8000
+	c.Execute()
+	if c.PC != 0x8001 {
+		t.Errorf("IRQ taken with every source released, PC = $%04X", c.PC)
+	}
+}
+
+func TestNMIBeforeIRQ(t *testing.T) {
+	_, c := newInterruptCPU()
+
+	c.SetIRQ(nes.IRQMapper, true)
+	c.SetNMI(true)
+	c.Execute()
+	if c.PC != 0x9000 {
+		t.Errorf("PC = $%04X with NMI and IRQ pending, want the NMI handler", c.PC)
+	}
+}
@@ -99,6 +99,11 @@ func (d *Debugger) memory(w http.ResponseWriter, r *http.Request) {
 func (d *Debugger) ppuMemory(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
+	if d.ppu == nil {
+		d.writeError(w, fmt.Errorf("No PPU in NSF player mode"))
+		return
+	}
+
 	j, err := d.getRange(d.ppu.Memory, r)
 
 	if err != nil {
@@ -112,6 +117,11 @@ func (d *Debugger) ppuMemory(w http.ResponseWriter, r *http.Request) {
 func (d *Debugger) oam(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
+	if d.ppu == nil {
+		d.writeError(w, fmt.Errorf("No PPU in NSF player mode"))
+		return
+	}
+
 	j, err := d.getRange(d.ppu.OAM, r)
 
 	if err != nil {
@@ -139,6 +149,72 @@ func (d *Debugger) stack(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// save exports the cartridge's battery backed RAM in .sav format
+func (d *Debugger) save(w http.ResponseWriter, r *http.Request) {
+	b, ok := d.nes.Mapper.(nes.Battery)
+	if !ok || b.BatteryRAM() == nil {
+		d.writeError(w, fmt.Errorf("Cartridge has no battery backed RAM"))
+		return
+	}
+
+	ram := b.BatteryRAM()
+	data := make([]byte, len(ram))
+	d.clock.Call(func() {
+		for i, v := range ram {
+			data[i] = *v
+		}
+	})
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", "attachment; filename=\"nesgo.sav\"")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// disk flips or ejects the Disk System disk. side=N puts side N (from 1) in,
+// anything else ejects it.
+func (d *Debugger) disk(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	drive, ok := d.nes.Mapper.(nes.DiskDrive)
+	if !ok {
+		d.writeError(w, fmt.Errorf("Cartridge has no disk drive"))
+		return
+	}
+
+	side, err := strconv.Atoi(r.URL.Query().Get("side"))
+	if err != nil || side < 1 || side > drive.Sides() {
+		d.clock.Call(drive.EjectDisk)
+	} else {
+		d.clock.Call(func() { drive.InsertDisk(side - 1) })
+	}
+
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, fmt.Sprintf(`{"sides":%v}`, drive.Sides()))
+}
+
+// track switches NSF tracks. track=N plays track N, counting from 1.
+func (d *Debugger) track(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	player, ok := d.nes.Mapper.(nes.Player)
+	if !ok {
+		d.writeError(w, fmt.Errorf("Not playing an NSF"))
+		return
+	}
+
+	track, err := strconv.Atoi(r.URL.Query().Get("track"))
+	d.clock.Call(func() {
+		if err == nil {
+			player.SelectTrack(track)
+		}
+		track = player.Track()
+	})
+
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, fmt.Sprintf(`{"track":%v,"tracks":%v}`, track, player.Tracks()))
+}
+
 func (d *Debugger) step(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	d.clock.Step()
@@ -239,6 +315,9 @@ func (d *Debugger) serve() {
 	http.HandleFunc("/disassembly", d.disassembly)
 	http.HandleFunc("/step", d.step)
 	http.HandleFunc("/img", d.img)
+	http.HandleFunc("/save", d.save)
+	http.HandleFunc("/disk", d.disk)
+	http.HandleFunc("/track", d.track)
 
 	http.ListenAndServe(":9905", nil)
 }
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/evandigby/nesgo/cpu"
+	"github.com/evandigby/nesgo/nes"
+	"github.com/evandigby/nesgo/ppu"
+	"github.com/evandigby/nesgo/rom"
+)
+
+const infoDisassemblyLength = 10
+
+type infoInstruction struct {
+	Address     string `json:"address"`
+	Bytes       string `json:"bytes"`
+	Disassembly string `json:"disassembly"`
+}
+
+type infoVectors struct {
+	NMI   string `json:"nmi"`
+	Reset string `json:"reset"`
+	IRQ   string `json:"irq"`
+}
+
+// romInfo is everything info knows about a ROM
+type romInfo struct {
+	File   string `json:"file"`
+	Patch  string `json:"patch,omitempty"`
+	Format string `json:"format"`
+
+	Mapper          int    `json:"mapper"`
+	Submapper       int    `json:"submapper"`
+	Mirroring       string `json:"mirroring"`
+	Battery         bool   `json:"battery"`
+	Trainer         bool   `json:"trainer"`
+	PRGSize         int    `json:"prgSize"`
+	CHRSize         int    `json:"chrSize"`
+	PRGRAMSize      int    `json:"prgRAMSize"`
+	PRGNVRAMSize    int    `json:"prgNVRAMSize"`
+	CHRRAMSize      int    `json:"chrRAMSize"`
+	CHRNVRAMSize    int    `json:"chrNVRAMSize"`
+	Timing          string `json:"timing"`
+	Console         string `json:"console"`
+	VsSystem        bool   `json:"vsSystem"`
+	PlayChoice10    bool   `json:"playChoice10"`
+	ExpansionDevice int    `json:"expansionDevice"`
+	LegacyHeader    bool   `json:"legacyHeader,omitempty"`
+
+	CRC32 string `json:"crc32"`
+	SHA1  string `json:"sha1"`
+
+	Database    string   `json:"database,omitempty"`
+	Corrections []string `json:"corrections,omitempty"`
+
+	Board  string `json:"board,omitempty"`
+	Title  string `json:"title,omitempty"`
+	Artist string `json:"artist,omitempty"`
+	Sides  int    `json:"sides,omitempty"`
+	Tracks int    `json:"tracks,omitempty"`
+
+	Vectors      *infoVectors      `json:"vectors,omitempty"`
+	VectorsError string            `json:"vectorsError,omitempty"`
+	Disassembly  []infoInstruction `json:"disassembly,omitempty"`
+}
+
+// info is the "nesgo info" command. It prints what we know about a ROM
+// without running it.
+func info(args []string) {
+	flags := flag.NewFlagSet("info", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print JSON instead of text")
+	patch := flags.String("patch", "", "IPS, UPS or BPS patch to apply instead of one found next to the ROM")
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		fmt.Printf("Usage: nesgo info [-json] [-patch file] <rom>\n")
+		os.Exit(2)
+	}
+
+	if err := loadGameDB(); err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+
+	romPath := flags.Arg(0)
+	if *patch == "" {
+		*patch = rom.FindPatch(romPath)
+	}
+
+	game, err := rom.OpenPatched(romPath, *patch)
+	if err != nil {
+		fmt.Printf("Error opening ROM: %v\n", err)
+		os.Exit(1)
+	}
+
+	i := inspect(game, romPath)
+	i.Patch = *patch
+
+	if *asJSON {
+		out, err := json.MarshalIndent(i, "", "  ")
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s\n", out)
+		return
+	}
+
+	printInfo(i)
+}
+
+func inspect(game rom.ROM, romPath string) *romInfo {
+	console := game.Console()
+	i := &romInfo{
+		File:            romPath,
+		Format:          "iNES",
+		Mapper:          game.Mapper(),
+		Submapper:       game.Submapper(),
+		Mirroring:       game.Mirroring().String(),
+		Battery:         game.PRGNVRAMSize() > 0,
+		Trainer:         len(game.Trainer()) > 0,
+		PRGSize:         len(game.ProgramRom()),
+		CHRSize:         len(game.CharRom()),
+		PRGRAMSize:      game.PRGRAMSize(),
+		PRGNVRAMSize:    game.PRGNVRAMSize(),
+		CHRRAMSize:      game.CHRRAMSize(),
+		CHRNVRAMSize:    game.CHRNVRAMSize(),
+		Timing:          game.Timing().String(),
+		Console:         console.String(),
+		VsSystem:        console == rom.ConsoleVsSystem,
+		PlayChoice10:    console == rom.ConsolePlayChoice10,
+		ExpansionDevice: game.ExpansionDevice(),
+	}
+
+	crc, sum := rom.Hash(game.ProgramRom(), game.CharRom())
+	i.CRC32 = fmt.Sprintf("%08X", crc)
+	i.SHA1 = sum
+
+	switch r := game.(type) {
+	case *rom.INES:
+		if r.NES2() {
+			i.Format = "NES 2.0"
+		}
+		i.LegacyHeader = r.LegacyHeader()
+		if g, ok := r.Game(); ok {
+			i.Database = g.Name
+			i.Corrections = r.Corrections()
+		}
+	case *rom.UNIF:
+		i.Format = "UNIF"
+		i.Board = r.Board()
+		i.Title = r.Name()
+	case *rom.FDS:
+		i.Format = "FDS"
+		i.Sides = len(r.Sides())
+	case *rom.NSF:
+		i.Format = "NSF"
+		i.Title = r.Title()
+		i.Artist = r.Artist()
+		i.Tracks = r.Songs()
+	}
+
+	n := nes.NewNES()
+	ppu.NewPPU(n, nil, nil)
+	cart, err := newCartridge(game, romPath)
+	if err != nil {
+		i.VectorsError = err.Error()
+		return i
+	}
+	n.Insert(cart)
+	n.Debug = true
+
+	vector := func(address uint16) uint16 {
+		return uint16(n.Get(address)) | uint16(n.Get(address+1))<<8
+	}
+	reset := vector(cpu.VectorReset)
+	i.Vectors = &infoVectors{
+		NMI:   fmt.Sprintf("$%04X", vector(cpu.VectorNMI)),
+		Reset: fmt.Sprintf("$%04X", reset),
+		IRQ:   fmt.Sprintf("$%04X", vector(cpu.VectorIRQ)),
+	}
+
+	address := int(reset)
+	for len(i.Disassembly) < infoDisassemblyLength && address < len(n.Memory) {
+		o := cpu.NewOpcode(n.Memory, uint16(address))
+		if o == nil {
+			i.Disassembly = append(i.Disassembly, infoInstruction{fmt.Sprintf("$%04X", address), fmt.Sprintf("%02X", *n.Memory[address]), "Unable to parse opcode"})
+			break
+		}
+		i.Disassembly = append(i.Disassembly, infoInstruction{fmt.Sprintf("$%04X", address), o.Bytes(), strings.TrimSpace(o.Disassemble())})
+		address += len(o.Opcode())
+	}
+
+	return i
+}
+
+func printInfo(i *romInfo) {
+	line := func(name string, value interface{}) {
+		fmt.Printf("%-18s %v\n", name+":", value)
+	}
+	size := func(bytes int) string {
+		if bytes%1024 == 0 {
+			return fmt.Sprintf("%vKB", bytes/1024)
+		}
+		return fmt.Sprintf("%v bytes", bytes)
+	}
+
+	line("File", i.File)
+	if i.Patch != "" {
+		line("Patch", i.Patch)
+	}
+	line("Format", i.Format)
+	if i.LegacyHeader {
+		line("Header", "bytes 7-15 hold junk and were ignored")
+	}
+	if i.Title != "" {
+		line("Title", i.Title)
+	}
+	if i.Artist != "" {
+		line("Artist", i.Artist)
+	}
+	if i.Board != "" {
+		line("Board", i.Board)
+	}
+	line("Mapper", i.Mapper)
+	line("Submapper", i.Submapper)
+	line("Mirroring", i.Mirroring)
+	line("Battery", i.Battery)
+	line("Trainer", i.Trainer)
+	line("PRG-ROM", size(i.PRGSize))
+	line("CHR-ROM", size(i.CHRSize))
+	line("PRG-RAM", size(i.PRGRAMSize))
+	line("PRG-NVRAM", size(i.PRGNVRAMSize))
+	line("CHR-RAM", size(i.CHRRAMSize))
+	line("CHR-NVRAM", size(i.CHRNVRAMSize))
+	line("Timing", i.Timing)
+	line("Console", i.Console)
+	line("Vs. System", i.VsSystem)
+	line("PlayChoice-10", i.PlayChoice10)
+	line("Expansion device", i.ExpansionDevice)
+	if i.Sides > 0 {
+		line("Disk sides", i.Sides)
+	}
+	if i.Tracks > 0 {
+		line("Tracks", i.Tracks)
+	}
+	line("CRC32", i.CRC32)
+	line("SHA-1", i.SHA1)
+	if i.Database != "" {
+		line("Database", i.Database)
+		for _, c := range i.Corrections {
+			line("Corrected", c)
+		}
+	}
+
+	if i.Vectors == nil {
+		line("Vectors", "unavailable: "+i.VectorsError)
+		return
+	}
+	line("NMI vector", i.Vectors.NMI)
+	line("Reset vector", i.Vectors.Reset)
+	line("IRQ vector", i.Vectors.IRQ)
+
+	fmt.Printf("\nDisassembly at reset:\n")
+	for _, d := range i.Disassembly {
+		fmt.Printf("  %v  %-9s %v\n", strings.TrimPrefix(d.Address, "$"), d.Bytes, d.Disassembly)
+	}
+}
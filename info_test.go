@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/evandigby/nesgo/rom"
+)
+
+// infoROM is an NROM-128 image with vertical mirroring, a battery and CHR-RAM.
+// Its reset routine is at $C000, NMI at $C100 and IRQ at $C200.
+func infoROM(t *testing.T) rom.ROM {
+	image := []byte{'N', 'E', 'S', 0x1A, 1, 0, 0x03, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	prg := make([]byte, 0x4000)
+	for i := range prg {
+		prg[i] = 0xEA // NOP
+	}
+	copy(prg, []byte{
+		0x78,       // SEI
+		0xD8,       // CLD
+		0xA2, 0xFF, // LDX #$FF
+		0x9A,             // TXS
+		0xAD, 0x02, 0x20, // LDA $2002
+		0x10, 0xFB, // BPL -5
+		0x4C, 0x00, 0xC0, // JMP $C000
+	})
+	copy(prg[0x3FFA:], []byte{0x00, 0xC1, 0x00, 0xC0, 0x00, 0xC2})
+
+	game, err := rom.Load(append(image, prg...))
+	if err != nil {
+		t.Fatalf("Unable to load test ROM: %v", err)
+	}
+	return game
+}
+
+func TestInspectJSON(t *testing.T) {
+	out, err := json.Marshal(inspect(infoROM(t), "game.nes"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Decode generically, so the test catches renamed fields
+	var got map[string]interface{}
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		"file":            "game.nes",
+		"format":          "iNES",
+		"mapper":          0.0,
+		"submapper":       0.0,
+		"mirroring":       rom.MirrorVertical.String(),
+		"battery":         true,
+		"trainer":         false,
+		"prgSize":         float64(0x4000),
+		"chrSize":         0.0,
+		"prgNVRAMSize":    float64(0x2000),
+		"chrRAMSize":      float64(0x2000),
+		"timing":          rom.TimingNTSC.String(),
+		"console":         rom.ConsoleNES.String(),
+		"vsSystem":        false,
+		"playChoice10":    false,
+		"expansionDevice": 0.0,
+	}
+	for field, value := range want {
+		if got[field] != value {
+			t.Errorf("%v is %#v, want %#v", field, got[field], value)
+		}
+	}
+	for _, field := range []string{"patch", "database", "board", "title", "sides", "tracks", "vectorsError"} {
+		if value, ok := got[field]; ok {
+			t.Errorf("%v is %#v, want it left out", field, value)
+		}
+	}
+	if crc, ok := got["crc32"].(string); !ok || len(crc) != 8 {
+		t.Errorf("crc32 is %#v, want 8 hex digits", got["crc32"])
+	}
+	if sum, ok := got["sha1"].(string); !ok || len(sum) != 40 {
+		t.Errorf("sha1 is %#v, want 40 hex digits", got["sha1"])
+	}
+
+	vectors, _ := got["vectors"].(map[string]interface{})
+	wantVectors := map[string]interface{}{"nmi": "$C100", "reset": "$C000", "irq": "$C200"}
+	for name, address := range wantVectors {
+		if vectors[name] != address {
+			t.Errorf("%v vector is %#v, want %v", name, vectors[name], address)
+		}
+	}
+
+	disassembly, _ := got["disassembly"].([]interface{})
+	if len(disassembly) != infoDisassemblyLength {
+		t.Fatalf("%v instructions disassembled, want %v", len(disassembly), infoDisassemblyLength)
+	}
+	wantLines := []struct{ address, bytes, disassembly string }{
+		{"$C000", "78", "SEI"},
+		{"$C001", "D8", "CLD"},
+		{"$C002", "A2 FF", "LDX #$FF"},
+		{"$C004", "9A", "TXS"},
+		{"$C005", "AD 02 20", "LDA $2002"},
+		{"$C008", "10 FB", "BPL $C005"},
+		{"$C00A", "4C 00 C0", "JMP $C000"},
+		{"$C00D", "EA", "NOP"},
+	}
+	for i, want := range wantLines {
+		line, _ := disassembly[i].(map[string]interface{})
+		if line["address"] != want.address || line["bytes"] != want.bytes || line["disassembly"] != want.disassembly {
+			t.Errorf("Line %v is %v, want %+v", i+1, line, want)
+		}
+	}
+}
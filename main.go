@@ -2,14 +2,22 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/evandigby/nesgo/clock"
 	"github.com/evandigby/nesgo/cpu"
 	"github.com/evandigby/nesgo/debug"
+	"github.com/evandigby/nesgo/mapper"
 	"github.com/evandigby/nesgo/nes"
 	"github.com/evandigby/nesgo/ppu"
 	"github.com/evandigby/nesgo/rom"
@@ -17,29 +25,59 @@ import (
 
 func main() {
 	runtime.GOMAXPROCS(runtime.NumCPU() - 1)
-	if len(os.Args) < 2 {
-		fmt.Printf("Not enough args\n")
+
+	if len(os.Args) > 1 && os.Args[1] == "info" {
+		info(os.Args[2:])
 		return
 	}
 
-	file, err := os.Open(os.Args[1])
+	patch := flag.String("patch", "", "IPS, UPS or BPS patch to apply instead of one found next to the ROM")
+	flag.Parse()
+	args := flag.Args()
+	if len(args) < 1 {
+		fmt.Printf("Not enough args\n")
+		return
+	}
+	romPath := args[0]
 
-	if err != nil {
-		fmt.Printf("Unable to open file %v\n", os.Args[1])
+	if err := loadGameDB(); err != nil {
+		fmt.Printf("%v\n", err)
 		return
 	}
-	defer file.Close()
 
-	ines, err := rom.NewINES(file)
+	if *patch == "" {
+		*patch = rom.FindPatch(romPath)
+	}
+	if *patch != "" {
+		fmt.Printf("Patching with %v\n", *patch)
+	}
+
+	game, err := rom.OpenPatched(romPath, *patch)
 
 	if err != nil {
-		fmt.Printf("Error opening iNES File: %v\n", err)
+		fmt.Printf("Error opening ROM: %v\n", err)
 		return
 	}
 
+	nsf, player := game.(*rom.NSF)
+	if player {
+		fmt.Printf("%v - %v (%v), %v tracks\n", nsf.Title(), nsf.Artist(), nsf.Copyright(), nsf.Songs())
+		fmt.Println("There's no APU yet, so the music plays silently")
+	} else {
+		fmt.Printf("Mapper %v, %v PRG pages, %v CHR pages, %v mirroring\n", game.Mapper(), game.Pages(), game.CharPages(), game.Mirroring())
+	}
+	if ines, ok := game.(*rom.INES); ok {
+		for _, c := range ines.Corrections() {
+			fmt.Printf("Header corrected by game database: %v\n", c)
+		}
+	}
+	if t := game.Trainer(); len(t) > 0 {
+		fmt.Printf("Trainer: %v bytes at $7000\n", len(t))
+	}
+
 	var cpuLog, nesLog *os.File
-	if len(os.Args) > 2 {
-		cpuLog, err = os.Create(os.Args[2])
+	if len(args) > 1 {
+		cpuLog, err = os.Create(args[1])
 		if err != nil {
 			fmt.Printf("Unable to create log %v\n", err)
 			return
@@ -56,16 +94,34 @@ func main() {
 		defer nesLog.Close()
 	}
 
-	ppuchan := make(chan int)
-
 	exit := make(chan bool)
 
 	n := nes.NewNES()
 
-	renderer := ppu.NewWebSocketRenderer("/play")
-	p := ppu.NewPPU(n, ppuchan, ines, renderer)
+	// The NSF player only needs the CPU
+	var ppuchan chan int
+	var p *ppu.PPU
+	if !player {
+		ppuchan = make(chan int)
+		renderer := ppu.NewWebSocketRenderer("/play")
+		p = ppu.NewPPU(n, ppuchan, renderer)
+	}
+
+	cart, err := newCartridge(game, romPath)
+	if err != nil {
+		fmt.Printf("Unable to load cartridge: %v\n", err)
+		return
+	}
 
-	n.LoadRom(ines)
+	// The save goes in before the cartridge does, so a trainer lands on top
+	// of it
+	save := mapper.NewSaveFile(romPath, cart)
+	if save != nil {
+		if err := save.Load(); err != nil {
+			fmt.Printf("Unable to load save %v: %v\n", save.Path(), err)
+		}
+	}
+	n.Insert(cart)
 
 	nesCPU := cpu.NewCPU(n, exit, cpuLog, nesLog)
 
@@ -75,7 +131,42 @@ func main() {
 	}
 	clock.Run()
 	nesCPU.Run()
-	p.Run()
+	if p != nil {
+		p.Run()
+	}
+
+	stopSaving := make(chan bool)
+	var saving <-chan bool
+	if save != nil {
+		saving = save.Autosave(5*time.Second, clock.Call, stopSaving, func(err error) {
+			fmt.Printf("Unable to write save %v: %v\n", save.Path(), err)
+		})
+	}
+	// flush stops autosaving, waiting for a save in progress, before writing
+	// the last one
+	var stopAutosave sync.Once
+	flush := func() {
+		if save == nil {
+			return
+		}
+		stopAutosave.Do(func() {
+			close(stopSaving)
+			<-saving
+		})
+		clock.Call(save.Capture)
+		if err := save.Flush(); err != nil {
+			fmt.Printf("Unable to write save %v: %v\n", save.Path(), err)
+		}
+	}
+	defer flush()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		flush()
+		os.Exit(1)
+	}()
 
 	go func() {
 		<-exit
@@ -129,9 +220,80 @@ func main() {
 				clock.Pause()
 			case "resume\n":
 				clock.Resume()
+			case "eject\n":
+				if d, ok := cart.(nes.DiskDrive); ok {
+					clock.Call(d.EjectDisk)
+				}
+			default:
+				// "track 2" plays the second track of an NSF
+				if pl, ok := cart.(nes.Player); ok && strings.HasPrefix(text, "track ") {
+					track, err := strconv.Atoi(strings.TrimSpace(text[6:]))
+					if err != nil || track < 1 || track > pl.Tracks() {
+						fmt.Printf("Tracks are 1-%v\n", pl.Tracks())
+						break
+					}
+					clock.Call(func() { pl.SelectTrack(track) })
+				}
+				// "side 1" flips the disk to its second side
+				if d, ok := cart.(nes.DiskDrive); ok && strings.HasPrefix(text, "side ") {
+					side, err := strconv.Atoi(strings.TrimSpace(text[5:]))
+					if err != nil || side < 1 || side > d.Sides() {
+						fmt.Printf("Disk has sides 1-%v\n", d.Sides())
+						break
+					}
+					clock.Call(func() { d.InsertDisk(side - 1) })
+				}
 			}
 		}
 	}()
 
 	wg.Wait()
 }
+
+// loadGameDB adds the game database entries in $NESGO_GAMEDB, in the format
+// rom.LoadGameDB reads
+func loadGameDB() error {
+	path := os.Getenv("NESGO_GAMEDB")
+	if path == "" {
+		return nil
+	}
+
+	db, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("Unable to open game database %v", err)
+	}
+	defer db.Close()
+
+	if err := rom.LoadGameDB(db); err != nil {
+		return fmt.Errorf("Unable to load game database %v", err)
+	}
+
+	return nil
+}
+
+// newCartridge returns the mapper for a game. Disk System games run on the
+// RAM adapter, which needs the BIOS. It's looked for in $NESGO_FDS_BIOS, or
+// disksys.rom next to the game.
+func newCartridge(game rom.ROM, romPath string) (nes.Mapper, error) {
+	disk, ok := game.(*rom.FDS)
+	if !ok {
+		return mapper.New(game)
+	}
+
+	path := os.Getenv("NESGO_FDS_BIOS")
+	if path == "" {
+		path = filepath.Join(filepath.Dir(romPath), "disksys.rom")
+	}
+
+	bios, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read FDS BIOS: %v", err)
+	}
+
+	fds, err := mapper.NewFDS(disk, bios)
+	if err != nil {
+		return nil, err
+	}
+
+	return fds, nil
+}
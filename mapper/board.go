@@ -0,0 +1,152 @@
+package mapper
+
+import (
+	"github.com/evandigby/nesgo/nes"
+	"github.com/evandigby/nesgo/rom"
+)
+
+const (
+	prgRAMSize  = 0x2000
+	prgRAMBase  = 0x6000
+	chrRAMSize  = 0x2000
+	trainerBase = 0x7000
+)
+
+// board holds what every cartridge has in common: its ROM, 8KB of PRG-RAM at
+// $6000, and the console it's plugged into. Mappers embed it and swap banks
+// with mapPRG and mapCHR. Boards without CHR-ROM get CHR-RAM in its place,
+// which banks the same way.
+type board struct {
+	rom    rom.ROM
+	nes    *nes.NES
+	prg    []*byte
+	chr    []*byte
+	prgRAM []*byte
+	chrRAM bool
+
+	prgRAMDisabled bool
+	prgRAMReadOnly bool
+	noBusConflicts bool
+}
+
+func makeRAM(size int) []*byte {
+	tm := make([]byte, size)
+	ram := make([]*byte, size)
+	for i := range ram {
+		ram[i] = &tm[i]
+	}
+	return ram
+}
+
+func newBoard(r rom.ROM) *board {
+	b := &board{
+		rom:    r,
+		prg:    r.ProgramRom(),
+		chr:    r.CharRom(),
+		prgRAM: makeRAM(prgRAMSize),
+	}
+
+	if len(b.chr) == 0 {
+		size := r.CHRRAMSize() + r.CHRNVRAMSize()
+		if size < chrRAMSize {
+			size = chrRAMSize
+		}
+		b.chr = makeRAM(size)
+		b.chrRAM = true
+	}
+
+	return b
+}
+
+func (b *board) Attach(n *nes.NES) {
+	b.nes = n
+	n.MapPRG(prgRAMBase, bank(b.prgRAM, prgRAMSize, 0))
+	n.PPU.SetMirroring(b.rom.Mirroring())
+
+	// Trainers were written by copier devices that expected the code at $7000
+	// before the game started. Saves are loaded before Attach, so the trainer
+	// goes in on top.
+	for i, v := range b.rom.Trainer() {
+		*b.prgRAM[trainerBase-prgRAMBase+i] = *v
+	}
+}
+
+func (b *board) Read(address uint16, debug bool) byte {
+	if b.prgRAMDisabled && address >= prgRAMBase && address < 0x8000 {
+		return byte(address >> 8) // Open bus
+	}
+	return *b.nes.Memory[address]
+}
+
+func (b *board) Write(address uint16, value byte) {
+	if !b.prgRAMDisabled && !b.prgRAMReadOnly && address >= prgRAMBase && address < 0x8000 {
+		*b.nes.Memory[address] = value
+	}
+}
+
+func (b *board) WriteCHR(address uint16, value byte) {
+	// Only CHR-RAM is writable, and whichever bank is mapped gets the write
+	if b.chrRAM {
+		*b.nes.PPU.PatternTables()[address] = value
+	}
+}
+
+// BatteryRAM returns PRG-RAM when the header says it's battery backed
+func (b *board) BatteryRAM() []*byte {
+	if b.rom.PRGNVRAMSize() == 0 {
+		return nil
+	}
+	return b.prgRAM
+}
+
+// bank returns the size byte bank from rom. Negative banks count back from
+// the last one, and out of range banks wrap the way unconnected address lines
+// would. A ROM smaller than the bank repeats to fill it.
+func bank(rom []*byte, size int, n int) []*byte {
+	count := len(rom) / size
+	if count == 0 {
+		if len(rom) == 0 {
+			return nil
+		}
+		mirrored := make([]*byte, size)
+		for i := range mirrored {
+			mirrored[i] = rom[i%len(rom)]
+		}
+		return mirrored
+	}
+
+	n %= count
+	if n < 0 {
+		n += count
+	}
+
+	return rom[n*size : (n+1)*size]
+}
+
+// busConflict returns the value that ends up on the bus when the CPU writes
+// to ROM on boards that don't disable the ROM during writes. The ROM drives
+// the bus at the same time, and 0s win.
+func (b *board) busConflict(address uint16, value byte) byte {
+	if b.noBusConflicts {
+		return value
+	}
+	return value & *b.nes.Memory[address]
+}
+
+func (b *board) mapPRG(address uint16, size int, n int) {
+	b.nes.MapPRG(address, bank(b.prg, size, n))
+}
+
+func (b *board) mapCHR(address uint16, size int, n int) {
+	copy(b.nes.PPU.PatternTables()[address:], bank(b.chr, size, n))
+}
+
+func (b *board) setMirroring(mode rom.Mirroring) {
+	b.nes.PPU.SetMirroring(mode)
+}
+
+func (b *board) setIRQ(active bool) {
+	if b.nes.Interrupts != nil {
+		b.nes.Interrupts.SetIRQ(nes.IRQMapper, active)
+	}
+}
@@ -0,0 +1,86 @@
+package mapper
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/evandigby/nesgo/rom"
+)
+
+// chrRAMCart loads c with its header's CHR-RAM size byte replaced
+func chrRAMCart(t *testing.T, c testCart, size byte, ines2 bool) rom.ROM {
+	image := c.image()
+	image[11] = size
+	if !ines2 {
+		for i := 7; i < 16; i++ {
+			image[i] = 0
+		}
+	}
+
+	r, err := rom.NewINES(bytes.NewReader(image))
+	if err != nil {
+		t.Fatalf("Unable to load test cartridge: %v", err)
+	}
+	return r
+}
+
+func TestCHRRAMSize(t *testing.T) {
+	tests := []struct {
+		name  string
+		size  byte
+		ines2 bool
+		want  int
+	}{
+		{"NES 2.0 32KB", 0x09, true, 0x8000},
+		{"NES 2.0 too small", 0x01, true, 0x2000},
+		{"iNES default", 0, false, 0x2000},
+	}
+
+	for _, test := range tests {
+		m := NewNROM(chrRAMCart(t, testCart{prg: 2}, test.size, test.ines2))
+		if !m.chrRAM || len(m.chr) != test.want {
+			t.Errorf("%v: CHR-RAM %v with %v bytes, want %v", test.name, m.chrRAM, len(m.chr), test.want)
+		}
+	}
+}
+
+func TestCHRRAMIsWritable(t *testing.T) {
+	m := NewNROM(testCart{prg: 2}.rom(t))
+	_, p, _ := insert(m)
+
+	m.WriteCHR(0x1234, 0x42)
+	if got := *p.patterns[0x1234]; got != 0x42 {
+		t.Errorf("CHR-RAM read $%02X after writing $42", got)
+	}
+}
+
+func TestCHRRAMBanks(t *testing.T) {
+	m := NewCNROM(chrRAMCart(t, testCart{mapper: 3, submapper: 1, prg: 2}, 0x09, true))
+	_, p, _ := insert(m)
+
+	m.WriteCHR(0x0010, 0xAA)
+	m.Write(0x8000, 2)
+	if got := *p.patterns[0x0010]; got != 0 {
+		t.Errorf("Bank 2 reads $%02X, want its own empty RAM", got)
+	}
+	m.WriteCHR(0x0010, 0xBB)
+
+	m.Write(0x8000, 0)
+	if got := *p.patterns[0x0010]; got != 0xAA {
+		t.Errorf("Bank 0 reads $%02X after switching back, want $AA", got)
+	}
+	m.Write(0x8000, 2)
+	if got := *p.patterns[0x0010]; got != 0xBB {
+		t.Errorf("Bank 2 reads $%02X after switching back, want $BB", got)
+	}
+}
+
+func TestCHRROMIgnoresWrites(t *testing.T) {
+	m := NewNROM(testCart{prg: 2, chr: 1}.rom(t))
+	_, p, _ := insert(m)
+
+	m.WriteCHR(0x0000, 0x42)
+	if got := *p.patterns[0]; got != 0 {
+		t.Errorf("Write to CHR-ROM went through, $0000 reads $%02X", got)
+	}
+}
@@ -0,0 +1,157 @@
+package mapper
+
+import (
+	"github.com/evandigby/nesgo/nes"
+	"github.com/evandigby/nesgo/rom"
+)
+
+// The boards in this file are built from discrete logic: a latch anywhere in
+// $8000-$FFFF that drives the upper PRG and CHR address lines. All of them
+// are subject to bus conflicts, unless an NES 2.0 header says otherwise.
+
+// latchBoard is a board for mappers 2, 3 and 7, where submapper 1 marks
+// carts that disable the ROM during writes. Submapper 2, and 0 for headers
+// that don't say, keep the bus conflicts.
+func latchBoard(r rom.ROM) *board {
+	b := newBoard(r)
+	b.noBusConflicts = r.Submapper() == 1
+	return b
+}
+
+// UxROM (mapper 2) switches 16KB at $8000 with the last bank fixed at $C000
+type UxROM struct {
+	*board
+}
+
+func NewUxROM(r rom.ROM) *UxROM {
+	return &UxROM{latchBoard(r)}
+}
+
+func (m *UxROM) Attach(n *nes.NES) {
+	m.board.Attach(n)
+	m.mapPRG(0x8000, 0x4000, 0)
+	m.mapPRG(0xC000, 0x4000, -1)
+	m.mapCHR(0x0000, 0x2000, 0)
+}
+
+func (m *UxROM) Write(address uint16, value byte) {
+	if address < 0x8000 {
+		m.board.Write(address, value)
+		return
+	}
+
+	value = m.busConflict(address, value)
+	m.mapPRG(0x8000, 0x4000, int(value))
+}
+
+// CNROM (mapper 3) switches 8KB of CHR
+type CNROM struct {
+	*board
+}
+
+func NewCNROM(r rom.ROM) *CNROM {
+	return &CNROM{latchBoard(r)}
+}
+
+func (m *CNROM) Attach(n *nes.NES) {
+	m.board.Attach(n)
+	m.mapPRG(0x8000, 0x4000, 0)
+	m.mapPRG(0xC000, 0x4000, -1)
+	m.mapCHR(0x0000, 0x2000, 0)
+}
+
+func (m *CNROM) Write(address uint16, value byte) {
+	if address < 0x8000 {
+		m.board.Write(address, value)
+		return
+	}
+
+	value = m.busConflict(address, value)
+	m.mapCHR(0x0000, 0x2000, int(value))
+}
+
+// AxROM (mapper 7) switches 32KB of PRG and selects which nametable is used
+// for single screen mirroring.
+type AxROM struct {
+	*board
+}
+
+func NewAxROM(r rom.ROM) *AxROM {
+	return &AxROM{latchBoard(r)}
+}
+
+func (m *AxROM) Attach(n *nes.NES) {
+	m.board.Attach(n)
+	m.mapPRG(0x8000, 0x8000, 0)
+	m.mapCHR(0x0000, 0x2000, 0)
+	m.setMirroring(rom.MirrorSingleA)
+}
+
+func (m *AxROM) Write(address uint16, value byte) {
+	if address < 0x8000 {
+		m.board.Write(address, value)
+		return
+	}
+
+	value = m.busConflict(address, value)
+	m.mapPRG(0x8000, 0x8000, int(value&0x07))
+	if value&0x10 == 0 {
+		m.setMirroring(rom.MirrorSingleA)
+	} else {
+		m.setMirroring(rom.MirrorSingleB)
+	}
+}
+
+// GxROM (mapper 66) switches 32KB of PRG with bits 4-5 and 8KB of CHR with
+// bits 0-1.
+type GxROM struct {
+	*board
+}
+
+func NewGxROM(r rom.ROM) *GxROM {
+	return &GxROM{newBoard(r)}
+}
+
+func (m *GxROM) Attach(n *nes.NES) {
+	m.board.Attach(n)
+	m.mapPRG(0x8000, 0x8000, 0)
+	m.mapCHR(0x0000, 0x2000, 0)
+}
+
+func (m *GxROM) Write(address uint16, value byte) {
+	if address < 0x8000 {
+		m.board.Write(address, value)
+		return
+	}
+
+	value = m.busConflict(address, value)
+	m.mapPRG(0x8000, 0x8000, int((value>>4)&0x03))
+	m.mapCHR(0x0000, 0x2000, int(value&0x03))
+}
+
+// ColorDreams (mapper 11) is GxROM with the nibbles swapped and more lines
+// connected: 32KB PRG with bits 0-1 and 8KB CHR with bits 4-7.
+type ColorDreams struct {
+	*board
+}
+
+func NewColorDreams(r rom.ROM) *ColorDreams {
+	return &ColorDreams{newBoard(r)}
+}
+
+func (m *ColorDreams) Attach(n *nes.NES) {
+	m.board.Attach(n)
+	m.mapPRG(0x8000, 0x8000, 0)
+	m.mapCHR(0x0000, 0x2000, 0)
+}
+
+func (m *ColorDreams) Write(address uint16, value byte) {
+	if address < 0x8000 {
+		m.board.Write(address, value)
+		return
+	}
+
+	value = m.busConflict(address, value)
+	m.mapPRG(0x8000, 0x8000, int(value&0x03))
+	m.mapCHR(0x0000, 0x2000, int(value>>4))
+}
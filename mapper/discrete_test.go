@@ -0,0 +1,79 @@
+package mapper
+
+import (
+	"testing"
+
+	"github.com/evandigby/nesgo/nes"
+	"github.com/evandigby/nesgo/rom"
+)
+
+func TestUxROMBanks(t *testing.T) {
+	m := NewUxROM(testCart{mapper: 2, submapper: 1, prg: 8, chr: 1}.rom(t))
+	n, _, _ := insert(m)
+
+	m.Write(0x8000, 3)
+	if got, want := prgBanks(n), [4]int{6, 7, 14, 15}; got != want {
+		t.Errorf("PRG banks %v, want %v", got, want)
+	}
+}
+
+func TestCNROMBanks(t *testing.T) {
+	m := NewCNROM(testCart{mapper: 3, submapper: 1, prg: 2, chr: 4}.rom(t))
+	_, p, _ := insert(m)
+
+	m.Write(0x8000, 2)
+	if got, want := chrBanks(p), [8]int{16, 17, 18, 19, 20, 21, 22, 23}; got != want {
+		t.Errorf("CHR banks %v, want %v", got, want)
+	}
+}
+
+func TestAxROMBanks(t *testing.T) {
+	m := NewAxROM(testCart{mapper: 7, submapper: 1, prg: 8, chr: 1}.rom(t))
+	n, p, _ := insert(m)
+
+	if p.mirroring != rom.MirrorSingleA {
+		t.Errorf("Mirroring %v at power on, want single screen A", p.mirroring)
+	}
+
+	m.Write(0x8000, 0x12)
+	if got, want := prgBanks(n), [4]int{8, 9, 10, 11}; got != want {
+		t.Errorf("PRG banks %v, want %v", got, want)
+	}
+	if p.mirroring != rom.MirrorSingleB {
+		t.Errorf("Mirroring %v, want single screen B", p.mirroring)
+	}
+}
+
+// Writing 1 over a ROM byte of 0 selects bank 0 when the ROM fights the
+// write, and bank 1 when it doesn't.
+func TestBusConflictsBySubmapper(t *testing.T) {
+	tests := []struct {
+		mapper   int
+		bank     func(n *nes.NES, p *testPPU) int
+		banked   int
+		conflict int
+	}{
+		{2, func(n *nes.NES, p *testPPU) int { return prgBanks(n)[0] }, 2, 0},
+		{3, func(n *nes.NES, p *testPPU) int { return chrBanks(p)[0] }, 8, 0},
+		{7, func(n *nes.NES, p *testPPU) int { return prgBanks(n)[0] }, 4, 0},
+	}
+
+	for _, test := range tests {
+		for submapper, conflicts := range []bool{true, false, true} {
+			m, err := New(testCart{mapper: test.mapper, submapper: submapper, prg: 8, chr: 2}.rom(t))
+			if err != nil {
+				t.Fatalf("Mapper %v: %v", test.mapper, err)
+			}
+			n, p, _ := insert(m)
+
+			m.Write(0x8000, 1)
+			want := test.banked
+			if conflicts {
+				want = test.conflict
+			}
+			if got := test.bank(n, p); got != want {
+				t.Errorf("Mapper %v submapper %v: bank %v, want %v", test.mapper, submapper, got, want)
+			}
+		}
+	}
+}
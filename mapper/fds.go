@@ -0,0 +1,378 @@
+package mapper
+
+import (
+	"fmt"
+
+	"github.com/evandigby/nesgo/nes"
+	"github.com/evandigby/nesgo/rom"
+)
+
+const (
+	fdsBIOSSize = 0x2000
+	fdsRAMSize  = 0x8000
+
+	// A bit takes about 18.6 CPU cycles to pass under the head
+	fdsByteCycles = 150
+
+	// Gaps before the first block and between blocks, in bytes
+	fdsLeadingGap = 28300 / 8
+	fdsBlockGap   = 976 / 8
+
+	// How long the head takes to get back to the start of the disk, and how
+	// long a disk stays out of the drive when switching sides
+	fdsRewindCycles = 50000
+	fdsInsertCycles = 1789773
+)
+
+// FDS is the Famicom Disk System RAM adapter. It has 32KB of PRG-RAM at
+// $6000, the BIOS at $E000, 8KB of CHR-RAM, a timer IRQ, and the disk drive,
+// which streams a byte every 150 CPU cycles and raises an IRQ for each one.
+//
+// Disk sides are stored the way they sit on the disk, with the gaps and CRCs
+// the image file leaves out.
+type FDS struct {
+	*board
+
+	Audio ExpansionAudio
+
+	bios  []*byte
+	disks [][]byte
+
+	diskRegs  bool
+	soundRegs bool
+
+	timerReload  uint16
+	timerCounter uint16
+	timerRepeat  bool
+	timerEnabled bool
+	timerIRQ     bool
+
+	side        int
+	pendingSide int
+	insertDelay int
+
+	motorOn       bool
+	resetTransfer bool
+	readMode      bool
+	crcControl    bool
+	diskReady     bool
+	diskIRQOn     bool
+	diskIRQ       bool
+	scanning      bool
+	endOfHead     bool
+	gapEnded      bool
+	transferred   bool
+	position      int
+	delay         int
+	readData      byte
+	writeData     byte
+}
+
+// NewFDS returns the RAM adapter with the disk inserted, first side up. The
+// BIOS isn't part of the disk image and has to come from the user.
+func NewFDS(r *rom.FDS, bios []byte) (*FDS, error) {
+	if len(bios) != fdsBIOSSize {
+		return nil, fmt.Errorf("FDS BIOS should be %v bytes, not %v", fdsBIOSSize, len(bios))
+	}
+
+	m := &FDS{board: newBoard(r), pendingSide: -1}
+	m.prgRAM = makeRAM(fdsRAMSize)
+
+	m.bios = makeRAM(fdsBIOSSize)
+	for i, b := range bios {
+		*m.bios[i] = b
+	}
+
+	for _, side := range r.Sides() {
+		m.disks = append(m.disks, gapDisk(side))
+	}
+
+	return m, nil
+}
+
+// gapDisk lays out a disk side the way the drive sees it. Every block starts
+// after a gap of zeros and a $80 start mark, and ends with a CRC. The BIOS
+// only cares whether the drive says the CRC was good, so it's left as a
+// placeholder.
+func gapDisk(side []byte) []byte {
+	disk := make([]byte, fdsLeadingGap, len(side)+0x1000)
+
+	block := func(size int) bool {
+		if size > len(side) {
+			return false
+		}
+		disk = append(disk, 0x80)
+		disk = append(disk, side[:size]...)
+		disk = append(disk, 0x4D, 0x62)
+		disk = append(disk, make([]byte, fdsBlockGap)...)
+		side = side[size:]
+		return true
+	}
+
+	// Disk info and file count blocks, then a header and data block per file
+	block(56)
+	block(2)
+	for len(side) >= 16 && side[0] == 3 {
+		size := int(side[13]) | int(side[14])<<8
+		if !block(16) || len(side) == 0 || side[0] != 4 || !block(size+1) {
+			break
+		}
+	}
+
+	for len(disk) < 65500 {
+		disk = append(disk, 0)
+	}
+
+	return disk
+}
+
+func (m *FDS) Attach(n *nes.NES) {
+	m.board.Attach(n)
+	n.MapPRG(prgRAMBase, m.prgRAM)
+	n.MapPRG(0xE000, m.bios)
+	m.mapCHR(0x0000, 0x2000, 0)
+}
+
+func (m *FDS) Sides() int {
+	return len(m.disks)
+}
+
+// InsertDisk ejects the current disk and puts side in after about a second,
+// the time the BIOS needs to notice the disk was taken out.
+func (m *FDS) InsertDisk(side int) {
+	if side < 0 || side >= len(m.disks) {
+		return
+	}
+	m.EjectDisk()
+	m.pendingSide = side
+	m.insertDelay = fdsInsertCycles
+}
+
+func (m *FDS) EjectDisk() {
+	m.side = -1
+	m.pendingSide = -1
+	m.insertDelay = 0
+}
+
+func (m *FDS) inserted() bool {
+	return m.side >= 0 && m.side < len(m.disks)
+}
+
+func (m *FDS) updateIRQ() {
+	m.setIRQ(m.timerIRQ || m.diskIRQ)
+}
+
+func (m *FDS) Read(address uint16, debug bool) byte {
+	if address >= prgRAMBase {
+		return m.board.Read(address, debug)
+	}
+	if !m.diskRegs || address < 0x4030 || address > 0x4033 {
+		return byte(address >> 8) // Open bus
+	}
+
+	switch address {
+	case 0x4030:
+		val := byte(0)
+		if m.timerIRQ {
+			val |= 0x01
+		}
+		if m.transferred {
+			val |= 0x02
+		}
+		if m.endOfHead {
+			val |= 0x40
+		}
+		if !debug {
+			m.transferred = false
+			m.timerIRQ = false
+			m.diskIRQ = false
+			m.updateIRQ()
+		}
+		return val
+	case 0x4031:
+		if !debug {
+			m.transferred = false
+			m.diskIRQ = false
+			m.updateIRQ()
+		}
+		return m.readData
+	case 0x4032:
+		val := byte(0x40)
+		if !m.inserted() {
+			val |= 0x07
+		} else if !m.scanning {
+			val |= 0x02
+		}
+		return val
+	default:
+		return 0x80 // Battery is good
+	}
+}
+
+func (m *FDS) Write(address uint16, value byte) {
+	switch {
+	case address == 0x4023:
+		m.diskRegs = value&0x01 != 0
+		m.soundRegs = value&0x02 != 0
+		if !m.diskRegs {
+			m.timerEnabled = false
+			m.timerIRQ = false
+			m.diskIRQ = false
+			m.updateIRQ()
+		}
+	case address >= 0x4020 && address <= 0x4026:
+		if m.diskRegs {
+			m.writeDiskRegister(address, value)
+		}
+	case address >= 0x4040 && address < 0x4100:
+		if m.soundRegs && m.Audio != nil {
+			m.Audio.WriteAudio(address, value)
+		}
+	case address >= prgRAMBase && address < 0xE000:
+		*m.nes.Memory[address] = value
+	}
+}
+
+func (m *FDS) writeDiskRegister(address uint16, value byte) {
+	switch address {
+	case 0x4020:
+		m.timerReload = (m.timerReload & 0xFF00) | uint16(value)
+	case 0x4021:
+		m.timerReload = (m.timerReload & 0x00FF) | uint16(value)<<8
+	case 0x4022:
+		m.timerRepeat = value&0x01 != 0
+		m.timerEnabled = value&0x02 != 0
+		if m.timerEnabled {
+			m.timerCounter = m.timerReload
+		} else {
+			m.timerIRQ = false
+			m.updateIRQ()
+		}
+	case 0x4024:
+		m.writeData = value
+		m.transferred = false
+		m.diskIRQ = false
+		m.updateIRQ()
+	case 0x4025:
+		m.motorOn = value&0x01 != 0
+		m.resetTransfer = value&0x02 != 0
+		m.readMode = value&0x04 != 0
+		if value&0x08 != 0 {
+			m.setMirroring(rom.MirrorHorizontal)
+		} else {
+			m.setMirroring(rom.MirrorVertical)
+		}
+		m.crcControl = value&0x10 != 0
+		m.diskReady = value&0x40 != 0
+		m.diskIRQOn = value&0x80 != 0
+		m.diskIRQ = false
+		m.updateIRQ()
+	}
+}
+
+func (m *FDS) CPUCycles(cycles int) {
+	for i := 0; i < cycles; i++ {
+		m.clockTimer()
+		m.clockDisk()
+	}
+}
+
+func (m *FDS) clockTimer() {
+	if !m.timerEnabled {
+		return
+	}
+
+	if m.timerCounter > 0 {
+		m.timerCounter--
+		return
+	}
+
+	m.timerIRQ = true
+	m.updateIRQ()
+	m.timerCounter = m.timerReload
+	if !m.timerRepeat {
+		m.timerEnabled = false
+	}
+}
+
+// clockDisk moves the disk under the head. Every 150 cycles the next byte is
+// read or written. Reads only start once the head has passed the end of a
+// gap, which is how the BIOS finds the start of each block.
+func (m *FDS) clockDisk() {
+	if m.insertDelay > 0 {
+		m.insertDelay--
+		if m.insertDelay == 0 {
+			m.side = m.pendingSide
+		}
+	}
+
+	if !m.inserted() || !m.motorOn {
+		m.endOfHead = true
+		m.scanning = false
+		return
+	}
+
+	if m.resetTransfer && !m.scanning {
+		return
+	}
+
+	if m.endOfHead {
+		m.delay = fdsRewindCycles
+		m.endOfHead = false
+		m.position = 0
+		m.gapEnded = false
+		return
+	}
+
+	if m.delay > 0 {
+		m.delay--
+		return
+	}
+
+	m.scanning = true
+	disk := m.disks[m.side]
+	irq := m.diskIRQOn
+
+	if m.readMode {
+		data := disk[m.position]
+		switch {
+		case !m.diskReady:
+			m.gapEnded = false
+		case !m.gapEnded:
+			// The start mark ends the gap but isn't handed to the BIOS
+			m.gapEnded = data != 0
+		default:
+			m.transferred = true
+			m.readData = data
+			if irq {
+				m.diskIRQ = true
+				m.updateIRQ()
+			}
+		}
+	} else {
+		data := byte(0)
+		if !m.crcControl {
+			m.transferred = true
+			data = m.writeData
+			if irq {
+				m.diskIRQ = true
+				m.updateIRQ()
+			}
+		}
+		if !m.diskReady {
+			data = 0
+		}
+		// While the BIOS asks for the CRC to be written the placeholder stays
+		if !m.crcControl {
+			disk[m.position] = data
+		}
+		m.gapEnded = false
+	}
+
+	m.position++
+	if m.position >= len(disk) {
+		m.motorOn = false
+	} else {
+		m.delay = fdsByteCycles
+	}
+}
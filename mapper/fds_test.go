@@ -0,0 +1,186 @@
+package mapper
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/evandigby/nesgo/rom"
+)
+
+// fdsDisk is a raw disk image with a side for each file given. The side
+// number is stored in the disk info block, so sides can be told apart.
+func fdsDisk(t *testing.T, files ...[]byte) *rom.FDS {
+	var image []byte
+	for i, file := range files {
+		side := make([]byte, 56)
+		copy(side, "\x01*NINTENDO-HVC*")
+		side[0x15] = byte(i)
+		side = append(side, 0x02, 1)
+		header := make([]byte, 16)
+		header[0] = 0x03
+		header[13] = byte(len(file))
+		header[14] = byte(len(file) >> 8)
+		side = append(side, header...)
+		side = append(side, 0x04)
+		side = append(side, file...)
+		image = append(image, side...)
+		image = append(image, make([]byte, 65500-len(side))...)
+	}
+
+	r, err := rom.NewFDS(bytes.NewReader(image))
+	if err != nil {
+		t.Fatalf("Unable to load test disk: %v", err)
+	}
+	return r.(*rom.FDS)
+}
+
+func newTestFDS(t *testing.T, files ...[]byte) *FDS {
+	m, err := NewFDS(fdsDisk(t, files...), make([]byte, fdsBIOSSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// diskWait is long enough for the head to rewind and reach the first block
+const diskWait = fdsRewindCycles + (fdsLeadingGap+2)*(fdsByteCycles+1)
+
+// readDisk acknowledges the next disk IRQ the way the BIOS does and returns
+// the byte read
+func readDisk(t *testing.T, m *FDS, irq *testInterrupts) byte {
+	t.Helper()
+	if irqCycle(m, irq, diskWait) == 0 {
+		t.Fatalf("No disk IRQ")
+	}
+	if status := m.Read(0x4030, false); status&0x02 == 0 {
+		t.Errorf("Disk IRQ without a byte transferred: $4030 reads $%02X", status)
+	}
+	return m.Read(0x4031, false)
+}
+
+func TestFDSDiskRead(t *testing.T) {
+	m := newTestFDS(t, []byte("file"))
+	_, _, irq := insert(m)
+
+	m.Write(0x4023, 0x01)
+	m.Write(0x4025, 0xC5) // Motor on, read mode, ready, disk IRQs
+
+	// Nothing is transferred until the first byte after the start mark
+	for cycle := 1; m.Read(0x4030, true)&0x02 == 0; cycle++ {
+		if cycle > diskWait {
+			t.Fatalf("Nothing transferred after the leading gap")
+		}
+		m.CPUCycles(1)
+	}
+	if !irq.irq {
+		t.Errorf("First byte transferred without an IRQ")
+	}
+	if got := m.Read(0x4031, false); got != 0x01 {
+		t.Errorf("First byte read $%02X, want the disk info block's $01", got)
+	}
+	if irq.irq {
+		t.Errorf("IRQ still asserted after reading $4031")
+	}
+
+	for i, want := range []byte("*NINTENDO-HVC*") {
+		if got := readDisk(t, m, irq); got != want {
+			t.Errorf("Byte %v read $%02X, want $%02X", i+1, got, want)
+		}
+	}
+
+	// Without disk IRQs bytes still arrive, and are polled for
+	m.Write(0x4025, 0x45)
+	if got := irqCycle(m, irq, 2*fdsByteCycles); got != 0 {
+		t.Errorf("Disk IRQ on cycle %v with disk IRQs off", got)
+	}
+	if m.Read(0x4030, false)&0x02 == 0 {
+		t.Errorf("No byte transferred with disk IRQs off")
+	}
+}
+
+func TestFDSTimerIRQ(t *testing.T) {
+	m := newTestFDS(t, nil)
+	_, _, irq := insert(m)
+
+	m.Write(0x4023, 0x01)
+	m.Write(0x4020, 100)
+	m.Write(0x4021, 0)
+	m.Write(0x4022, 0x03) // Repeat and enable
+
+	for i := 0; i < 2; i++ {
+		if got := irqCycle(m, irq, 1000); got != 101 {
+			t.Errorf("Timer IRQ %v on cycle %v, want 101", i+1, got)
+		}
+		if status := m.Read(0x4030, false); status&0x01 == 0 {
+			t.Errorf("$4030 reads $%02X, want the timer flag set", status)
+		}
+		if irq.irq {
+			t.Errorf("Timer IRQ still asserted after reading $4030")
+		}
+	}
+
+	// Without repeat the timer stops after one IRQ
+	m.Write(0x4022, 0x02)
+	if got := irqCycle(m, irq, 1000); got != 101 {
+		t.Errorf("One shot timer IRQ on cycle %v, want 101", got)
+	}
+	m.Read(0x4030, false)
+	if got := irqCycle(m, irq, 1000); got != 0 {
+		t.Errorf("One shot timer fired again on cycle %v", got)
+	}
+
+	// Turning off the disk registers stops the timer and clears its IRQ
+	m.Write(0x4022, 0x03)
+	irqCycle(m, irq, 1000)
+	m.Write(0x4023, 0x00)
+	if irq.irq {
+		t.Errorf("Timer IRQ still asserted with the disk registers off")
+	}
+	if got := irqCycle(m, irq, 1000); got != 0 {
+		t.Errorf("Timer IRQ on cycle %v with the disk registers off", got)
+	}
+}
+
+func TestFDSSideSwitching(t *testing.T) {
+	m := newTestFDS(t, []byte("side A"), []byte("side B"))
+	_, _, irq := insert(m)
+	m.Write(0x4023, 0x01)
+
+	if m.Sides() != 2 {
+		t.Fatalf("%v sides, want 2", m.Sides())
+	}
+	if status := m.Read(0x4032, false); status&0x01 != 0 {
+		t.Errorf("$4032 reads $%02X with the first side in", status)
+	}
+
+	m.InsertDisk(1)
+	if status := m.Read(0x4032, false); status&0x01 == 0 {
+		t.Errorf("$4032 reads $%02X while the disk is being flipped", status)
+	}
+	m.CPUCycles(fdsInsertCycles)
+	if status := m.Read(0x4032, false); status&0x01 != 0 {
+		t.Errorf("$4032 reads $%02X after the disk was flipped", status)
+	}
+
+	// The disk info block holds the side number
+	m.Write(0x4025, 0xC5)
+	var info [0x16]byte
+	for i := range info {
+		info[i] = readDisk(t, m, irq)
+	}
+	if info[0x15] != 1 {
+		t.Errorf("Read side %v, want side 2", info[0x15]+1)
+	}
+
+	// Sides that don't exist leave the disk alone
+	m.InsertDisk(2)
+	if status := m.Read(0x4032, false); status&0x01 != 0 {
+		t.Errorf("Inserting a missing side ejected the disk")
+	}
+
+	m.EjectDisk()
+	m.CPUCycles(fdsInsertCycles)
+	if status := m.Read(0x4032, false); status&0x01 == 0 {
+		t.Errorf("$4032 reads $%02X with the disk ejected", status)
+	}
+}
@@ -0,0 +1,111 @@
+package mapper
+
+import (
+	"github.com/evandigby/nesgo/nes"
+	"github.com/evandigby/nesgo/rom"
+)
+
+// FME7 (mapper 69) covers the Sunsoft FME-7, 5A and 5B. Registers are written
+// indirectly: a command is selected through $8000 and its parameter written
+// to $A000. The 5B adds three square wave channels at $C000/$E000.
+type FME7 struct {
+	*board
+
+	Audio ExpansionAudio
+
+	command byte
+	chr     [8]byte
+	prg     [4]byte // $6000-$DFFF
+
+	irqEnabled     bool
+	counterEnabled bool
+	counter        uint16
+}
+
+func NewFME7(r rom.ROM) *FME7 {
+	return &FME7{board: newBoard(r)}
+}
+
+func (m *FME7) Attach(n *nes.NES) {
+	m.board.Attach(n)
+	m.update()
+}
+
+// CPUCycles counts the IRQ counter down once per CPU cycle. The IRQ fires
+// when it wraps from $0000 to $FFFF.
+func (m *FME7) CPUCycles(cycles int) {
+	if !m.counterEnabled {
+		return
+	}
+
+	for i := 0; i < cycles; i++ {
+		m.counter--
+		if m.counter == 0xFFFF && m.irqEnabled {
+			m.setIRQ(true)
+		}
+	}
+}
+
+func (m *FME7) Write(address uint16, value byte) {
+	switch {
+	case address < 0x8000:
+		m.board.Write(address, value)
+	case address < 0xA000:
+		m.command = value & 0x0F
+	case address < 0xC000:
+		m.writeParameter(value)
+	default:
+		if m.Audio != nil {
+			m.Audio.WriteAudio(address&0xE000, value)
+		}
+	}
+}
+
+func (m *FME7) writeParameter(value byte) {
+	switch c := m.command; {
+	case c <= 0x07:
+		m.chr[c] = value
+	case c <= 0x0B:
+		m.prg[c-0x08] = value
+	case c == 0x0C:
+		m.setMirroring(vrcMirroring(value))
+	// The IRQ registers don't touch the banks, and are written too often to
+	// remap PRG every time
+	case c == 0x0D:
+		m.irqEnabled = value&0x01 != 0
+		m.counterEnabled = value&0x80 != 0
+		m.setIRQ(false)
+		return
+	case c == 0x0E:
+		m.counter = (m.counter & 0xFF00) | uint16(value)
+		return
+	case c == 0x0F:
+		m.counter = (m.counter & 0x00FF) | uint16(value)<<8
+		return
+	}
+
+	m.update()
+}
+
+func (m *FME7) update() {
+	// $6000 holds either a ROM bank or, with bit 6 set, PRG-RAM which is only
+	// enabled with bit 7
+	if m.prg[0]&0x40 != 0 {
+		m.nes.MapPRG(prgRAMBase, bank(m.prgRAM, prgRAMSize, 0))
+		m.prgRAMDisabled = m.prg[0]&0x80 == 0
+		m.prgRAMReadOnly = false
+	} else {
+		m.mapPRG(prgRAMBase, 0x2000, int(m.prg[0]&0x3F))
+		m.prgRAMDisabled = false
+		m.prgRAMReadOnly = true
+	}
+
+	m.mapPRG(0x8000, 0x2000, int(m.prg[1]&0x3F))
+	m.mapPRG(0xA000, 0x2000, int(m.prg[2]&0x3F))
+	m.mapPRG(0xC000, 0x2000, int(m.prg[3]&0x3F))
+	m.mapPRG(0xE000, 0x2000, -1)
+
+	for i, b := range m.chr {
+		m.mapCHR(uint16(i)*0x400, 0x400, int(b))
+	}
+}
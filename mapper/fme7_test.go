@@ -0,0 +1,85 @@
+package mapper
+
+import "testing"
+
+func writeFME7(m *FME7, command, value byte) {
+	m.Write(0x8000, command)
+	m.Write(0xA000, value)
+}
+
+func TestFME7Banks(t *testing.T) {
+	m := NewFME7(testCart{mapper: 69, prg: 8, chr: 8}.rom(t))
+	n, p, _ := insert(m)
+
+	for i := byte(0); i < 8; i++ {
+		writeFME7(m, i, 8*i+1)
+	}
+	writeFME7(m, 0x08, 0x02) // ROM bank 2 at $6000
+	writeFME7(m, 0x09, 3)
+	writeFME7(m, 0x0A, 4)
+	writeFME7(m, 0x0B, 5)
+
+	if got, want := prgBanks(n), [4]int{3, 4, 5, 15}; got != want {
+		t.Errorf("PRG banks %v, want %v", got, want)
+	}
+	if got, want := chrBanks(p), [8]int{1, 9, 17, 25, 33, 41, 49, 57}; got != want {
+		t.Errorf("CHR banks %v, want %v", got, want)
+	}
+	if got := *n.Memory[0x6000]; got != 2 {
+		t.Errorf("$6000 holds bank %v, want ROM bank 2", got)
+	}
+
+	// ROM at $6000 can't be written
+	m.Write(0x6000, 0x42)
+	if got := *n.Memory[0x6000]; got != 2 {
+		t.Errorf("Write went through to ROM at $6000")
+	}
+
+	writeFME7(m, 0x08, 0xC0) // Enabled PRG-RAM
+	m.Write(0x6000, 0x42)
+	if got := m.Read(0x6000, false); got != 0x42 {
+		t.Errorf("PRG-RAM read $%02X, want $42", got)
+	}
+}
+
+func TestFME7IRQ(t *testing.T) {
+	m := NewFME7(testCart{mapper: 69, prg: 2, chr: 1}.rom(t))
+	_, _, irq := insert(m)
+
+	writeFME7(m, 0x0E, 0x02)
+	writeFME7(m, 0x0F, 0x00)
+	writeFME7(m, 0x0D, 0x81) // Count and raise IRQs
+
+	// 2, 1, 0, then the IRQ as it wraps to $FFFF
+	if got := irqCycle(m, irq, 10); got != 3 {
+		t.Errorf("IRQ on cycle %v, want 3", got)
+	}
+
+	writeFME7(m, 0x0D, 0x80) // Acknowledge, keep counting
+	if irq.irq {
+		t.Errorf("IRQ still asserted after acknowledge")
+	}
+	if got := irqCycle(m, irq, 0x20000); got != 0 {
+		t.Errorf("IRQ on cycle %v with IRQs disabled", got)
+	}
+}
+
+func TestFME7IRQWritesDontRemap(t *testing.T) {
+	m := NewFME7(testCart{mapper: 69, prg: 2, chr: 1}.rom(t))
+	n, _, _ := insert(m)
+	n.Remapped()
+
+	writeFME7(m, 0x0E, 0x34)
+	writeFME7(m, 0x0F, 0x12)
+	writeFME7(m, 0x0D, 0x81)
+	m.Write(0xC000, 0x07) // 5B sound
+	m.Write(0xE000, 0x3F)
+	if start, end, ok := n.Remapped(); ok {
+		t.Errorf("IRQ and sound writes remapped $%04X-$%04X", start, end)
+	}
+
+	writeFME7(m, 0x09, 1)
+	if _, _, ok := n.Remapped(); !ok {
+		t.Errorf("PRG bank write didn't remap")
+	}
+}
@@ -0,0 +1,55 @@
+package mapper
+
+import (
+	"fmt"
+
+	"github.com/evandigby/nesgo/nes"
+	"github.com/evandigby/nesgo/rom"
+)
+
+// New returns the mapper for the board the ROM was built for
+func New(r rom.ROM) (nes.Mapper, error) {
+	switch r.Mapper() {
+	case 0:
+		return NewNROM(r), nil
+	case 1:
+		return NewMMC1(r), nil
+	case 2:
+		return NewUxROM(r), nil
+	case 3:
+		return NewCNROM(r), nil
+	case 4:
+		return NewMMC3(r), nil
+	case 5:
+		return NewMMC5(r), nil
+	case 7:
+		return NewAxROM(r), nil
+	case 9:
+		return NewMMC2(r), nil
+	case 10:
+		return NewMMC4(r), nil
+	case 11:
+		return NewColorDreams(r), nil
+	case 19:
+		return NewNamco163(r), nil
+	case rom.NSFMapper:
+		if nsf, ok := r.(*rom.NSF); ok {
+			return NewNSF(nsf), nil
+		}
+		return nil, fmt.Errorf("Mapper %v is only for NSF files", r.Mapper())
+	case rom.FDSMapper:
+		return nil, fmt.Errorf("FDS disks need a BIOS, use NewFDS")
+	case 21, 22, 23, 25:
+		return NewVRC4(r), nil
+	case 24, 26:
+		return NewVRC6(r), nil
+	case 66:
+		return NewGxROM(r), nil
+	case 69:
+		return NewFME7(r), nil
+	case 85:
+		return NewVRC7(r), nil
+	default:
+		return nil, fmt.Errorf("Unsupported mapper %v", r.Mapper())
+	}
+}
@@ -0,0 +1,161 @@
+package mapper
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/evandigby/nesgo/nes"
+	"github.com/evandigby/nesgo/rom"
+)
+
+// testPPU is just enough of a PPU for a cartridge to map CHR banks and
+// nametables into.
+type testPPU struct {
+	patterns   []*byte
+	nametables []*byte
+	tables     [4][]*byte
+	mirroring  rom.Mirroring
+}
+
+func newTestPPU() *testPPU {
+	return &testPPU{patterns: makeRAM(0x2000), nametables: makeRAM(0x1000)}
+}
+
+func (p *testPPU) PatternTables() []*byte               { return p.patterns }
+func (p *testPPU) SetMirroring(mode rom.Mirroring)      { p.mirroring = mode }
+func (p *testPPU) Nametable(page int) []*byte           { return p.nametables[page*0x400 : (page+1)*0x400] }
+func (p *testPPU) MapNametable(table int, page []*byte) { p.tables[table] = page }
+
+type testInterrupts struct {
+	irq bool
+}
+
+func (i *testInterrupts) SetNMI(active bool)                       {}
+func (i *testInterrupts) SetIRQ(source nes.IRQSource, active bool) { i.irq = active }
+
+// testCart describes an NES 2.0 image. PRG is in 16KB pages and CHR in 8KB
+// pages. Every byte of PRG holds the number of the 8KB bank it's in, and
+// every byte of CHR the number of its 1KB bank, so the banks mapped can be
+// read straight out of memory.
+type testCart struct {
+	mapper    int
+	submapper int
+	prg       int
+	chr       int
+	flags6    byte
+	trainer   []byte
+}
+
+func (c testCart) image() []byte {
+	header := []byte{
+		'N', 'E', 'S', 0x1A,
+		byte(c.prg), byte(c.chr),
+		c.flags6 | byte(c.mapper&0x0F)<<4,
+		0x08 | byte(c.mapper&0xF0),
+		byte(c.submapper)<<4 | byte(c.mapper>>8)&0x0F,
+		0, 0, 0, 0, 0, 0, 0,
+	}
+	if c.flags6&0x02 != 0 {
+		header[10] = 0x70 // 8KB of PRG-NVRAM
+	} else {
+		header[10] = 0x07 // 8KB of PRG-RAM
+	}
+	if c.chr == 0 {
+		header[11] = 0x07 // 8KB of CHR-RAM
+	}
+
+	data := append([]byte{}, header...)
+	if c.flags6&0x04 != 0 {
+		data = append(data, c.trainer...)
+	}
+	for i := 0; i < c.prg*0x4000; i++ {
+		data = append(data, byte(i/0x2000))
+	}
+	for i := 0; i < c.chr*0x2000; i++ {
+		data = append(data, byte(i/0x400))
+	}
+
+	return data
+}
+
+func (c testCart) rom(t *testing.T) rom.ROM {
+	r, err := rom.NewINES(bytes.NewReader(c.image()))
+	if err != nil {
+		t.Fatalf("Unable to load test cartridge: %v", err)
+	}
+	return r
+}
+
+// insert plugs a cartridge into a console with a test PPU
+func insert(m nes.Mapper) (*nes.NES, *testPPU, *testInterrupts) {
+	n := nes.NewNES()
+	p := newTestPPU()
+	irq := &testInterrupts{}
+	n.PPU = p
+	n.Interrupts = irq
+	n.Insert(m)
+	return n, p, irq
+}
+
+// prgBanks returns the 8KB banks mapped at $8000, $A000, $C000 and $E000
+func prgBanks(n *nes.NES) [4]int {
+	var banks [4]int
+	for i := range banks {
+		banks[i] = int(*n.Memory[0x8000+i*0x2000])
+	}
+	return banks
+}
+
+// chrBanks returns the 1KB banks mapped into the pattern tables
+func chrBanks(p *testPPU) [8]int {
+	var banks [8]int
+	for i := range banks {
+		banks[i] = int(*p.patterns[i*0x400])
+	}
+	return banks
+}
+
+type write struct {
+	address uint16
+	value   byte
+}
+
+func TestNewSelectsMapper(t *testing.T) {
+	tests := []struct {
+		mapper int
+		want   interface{}
+	}{
+		{0, &NROM{}},
+		{1, &MMC1{}},
+		{2, &UxROM{}},
+		{3, &CNROM{}},
+		{4, &MMC3{}},
+		{5, &MMC5{}},
+		{7, &AxROM{}},
+		{9, &MMC2{}},
+		{10, &MMC2{}},
+		{11, &ColorDreams{}},
+		{19, &Namco163{}},
+		{21, &VRC4{}},
+		{24, &VRC6{}},
+		{66, &GxROM{}},
+		{69, &FME7{}},
+		{85, &VRC7{}},
+	}
+
+	for _, test := range tests {
+		m, err := New(testCart{mapper: test.mapper, prg: 2, chr: 1}.rom(t))
+		if err != nil {
+			t.Errorf("Mapper %v: %v", test.mapper, err)
+			continue
+		}
+		if got, want := fmt.Sprintf("%T", m), fmt.Sprintf("%T", test.want); got != want {
+			t.Errorf("Mapper %v is %v, want %v", test.mapper, got, want)
+		}
+	}
+
+	if _, err := New(testCart{mapper: 255, prg: 2, chr: 1}.rom(t)); err == nil {
+		t.Errorf("Unsupported mapper didn't return an error")
+	}
+}
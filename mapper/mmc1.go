@@ -0,0 +1,103 @@
+package mapper
+
+import (
+	"github.com/evandigby/nesgo/nes"
+	"github.com/evandigby/nesgo/rom"
+)
+
+// MMC1 (mapper 1, SxROM) is programmed one bit at a time through a 5 bit
+// shift register. The fifth write copies the shift register into the
+// internal register selected by bits 13-14 of the address.
+type MMC1 struct {
+	*board
+
+	shift   byte
+	control byte
+	chr0    byte
+	chr1    byte
+	prgBank byte
+}
+
+func NewMMC1(r rom.ROM) *MMC1 {
+	return &MMC1{board: newBoard(r), shift: 0x10, control: 0x0C}
+}
+
+func (m *MMC1) Attach(n *nes.NES) {
+	m.board.Attach(n)
+	m.update()
+}
+
+func (m *MMC1) Write(address uint16, value byte) {
+	if address < 0x8000 {
+		m.board.Write(address, value)
+		return
+	}
+
+	if value&0x80 != 0 {
+		m.shift = 0x10
+		m.control |= 0x0C
+		m.update()
+		return
+	}
+
+	// The 1 written on reset reaches bit 0 on the fifth write
+	done := m.shift&1 != 0
+	m.shift = (m.shift >> 1) | ((value & 1) << 4)
+	if !done {
+		return
+	}
+
+	switch (address >> 13) & 3 {
+	case 0:
+		m.control = m.shift
+	case 1:
+		m.chr0 = m.shift
+	case 2:
+		m.chr1 = m.shift
+	case 3:
+		m.prgBank = m.shift
+	}
+	m.shift = 0x10
+	m.update()
+}
+
+func (m *MMC1) update() {
+	switch m.control & 3 {
+	case 0:
+		m.setMirroring(rom.MirrorSingleA)
+	case 1:
+		m.setMirroring(rom.MirrorSingleB)
+	case 2:
+		m.setMirroring(rom.MirrorVertical)
+	case 3:
+		m.setMirroring(rom.MirrorHorizontal)
+	}
+
+	// 512KB SUROM boards use the CHR bank's bit 4 to select the 256KB half
+	// of PRG-ROM.
+	var outer int
+	if m.rom.Pages() > 16 {
+		outer = int(m.chr0 & 0x10)
+	}
+
+	bank := int(m.prgBank & 0x0F)
+	switch (m.control >> 2) & 3 {
+	case 0, 1:
+		m.mapPRG(0x8000, 0x8000, (outer|bank)>>1)
+	case 2:
+		m.mapPRG(0x8000, 0x4000, outer)
+		m.mapPRG(0xC000, 0x4000, outer|bank)
+	case 3:
+		m.mapPRG(0x8000, 0x4000, outer|bank)
+		m.mapPRG(0xC000, 0x4000, outer|0x0F)
+	}
+
+	if m.control&0x10 == 0 {
+		m.mapCHR(0x0000, 0x2000, int(m.chr0>>1))
+	} else {
+		m.mapCHR(0x0000, 0x1000, int(m.chr0))
+		m.mapCHR(0x1000, 0x1000, int(m.chr1))
+	}
+
+	m.prgRAMDisabled = m.prgBank&0x10 != 0
+}
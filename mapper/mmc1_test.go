@@ -0,0 +1,125 @@
+package mapper
+
+import (
+	"testing"
+
+	"github.com/evandigby/nesgo/rom"
+)
+
+// writeMMC1 loads a register through the serial port, low bit first
+func writeMMC1(m *MMC1, address uint16, value byte) {
+	for i := uint(0); i < 5; i++ {
+		m.Write(address, (value>>i)&1)
+	}
+}
+
+func TestMMC1Banks(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []write
+		prg    [4]int
+		chr    [8]int
+	}{
+		{
+			name: "power on",
+			prg:  [4]int{0, 1, 30, 31},
+			chr:  [8]int{0, 1, 2, 3, 4, 5, 6, 7},
+		},
+		{
+			name:   "16KB at $8000, last bank fixed",
+			writes: []write{{0x8000, 0x0C}, {0xE000, 3}},
+			prg:    [4]int{6, 7, 30, 31},
+			chr:    [8]int{0, 1, 2, 3, 4, 5, 6, 7},
+		},
+		{
+			name:   "16KB at $C000, first bank fixed",
+			writes: []write{{0x8000, 0x08}, {0xE000, 3}},
+			prg:    [4]int{0, 1, 6, 7},
+			chr:    [8]int{0, 1, 2, 3, 4, 5, 6, 7},
+		},
+		{
+			name:   "32KB ignores the low bit",
+			writes: []write{{0x8000, 0x00}, {0xE000, 3}},
+			prg:    [4]int{4, 5, 6, 7},
+			chr:    [8]int{0, 1, 2, 3, 4, 5, 6, 7},
+		},
+		{
+			name:   "8KB CHR ignores the low bit",
+			writes: []write{{0x8000, 0x0C}, {0xA000, 5}, {0xC000, 9}},
+			prg:    [4]int{0, 1, 30, 31},
+			chr:    [8]int{16, 17, 18, 19, 20, 21, 22, 23},
+		},
+		{
+			name:   "two 4KB CHR banks",
+			writes: []write{{0x8000, 0x1C}, {0xA000, 5}, {0xC000, 9}},
+			prg:    [4]int{0, 1, 30, 31},
+			chr:    [8]int{20, 21, 22, 23, 36, 37, 38, 39},
+		},
+	}
+
+	for _, test := range tests {
+		m := NewMMC1(testCart{mapper: 1, prg: 16, chr: 16}.rom(t))
+		n, p, _ := insert(m)
+		for _, w := range test.writes {
+			writeMMC1(m, w.address, w.value)
+		}
+
+		if got := prgBanks(n); got != test.prg {
+			t.Errorf("%v: PRG banks %v, want %v", test.name, got, test.prg)
+		}
+		if got := chrBanks(p); got != test.chr {
+			t.Errorf("%v: CHR banks %v, want %v", test.name, got, test.chr)
+		}
+	}
+}
+
+func TestMMC1Mirroring(t *testing.T) {
+	modes := []rom.Mirroring{rom.MirrorSingleA, rom.MirrorSingleB, rom.MirrorVertical, rom.MirrorHorizontal}
+
+	m := NewMMC1(testCart{mapper: 1, prg: 2, chr: 1}.rom(t))
+	_, p, _ := insert(m)
+	for i, want := range modes {
+		writeMMC1(m, 0x8000, 0x0C|byte(i))
+		if p.mirroring != want {
+			t.Errorf("Control $%02X: mirroring %v, want %v", 0x0C|i, p.mirroring, want)
+		}
+	}
+}
+
+// Writing a value with bit 7 set clears the shift register, so the
+// interrupted write never lands, and puts PRG back in mode 3.
+func TestMMC1Reset(t *testing.T) {
+	m := NewMMC1(testCart{mapper: 1, prg: 16, chr: 1}.rom(t))
+	n, _, _ := insert(m)
+
+	writeMMC1(m, 0x8000, 0x08)
+	m.Write(0xE000, 1)
+	m.Write(0xE000, 1)
+	m.Write(0xE000, 0x80)
+	writeMMC1(m, 0xE000, 2)
+
+	if got, want := prgBanks(n), [4]int{4, 5, 30, 31}; got != want {
+		t.Errorf("PRG banks %v, want %v", got, want)
+	}
+}
+
+func TestMMC1PRGRAMEnable(t *testing.T) {
+	m := NewMMC1(testCart{mapper: 1, prg: 2, chr: 1}.rom(t))
+	insert(m)
+
+	m.Write(0x6000, 0x42)
+	if got := m.Read(0x6000, false); got != 0x42 {
+		t.Fatalf("PRG-RAM read $%02X, want $42", got)
+	}
+
+	writeMMC1(m, 0xE000, 0x10)
+	m.Write(0x6000, 0x99)
+	if got := m.Read(0x6000, false); got != 0x60 {
+		t.Errorf("Disabled PRG-RAM read $%02X, want open bus $60", got)
+	}
+
+	writeMMC1(m, 0xE000, 0x00)
+	if got := m.Read(0x6000, false); got != 0x42 {
+		t.Errorf("Re-enabled PRG-RAM read $%02X, want $42", got)
+	}
+}
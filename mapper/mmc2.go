@@ -0,0 +1,109 @@
+package mapper
+
+import (
+	"github.com/evandigby/nesgo/nes"
+	"github.com/evandigby/nesgo/rom"
+)
+
+// MMC2 (mapper 9, PxROM) and MMC4 (mapper 10, FxROM) have two CHR banks for
+// each 4KB pattern table, and a latch per table that picks between them. The
+// latches flip when the PPU fetches the last row of tile $FD or $FE, so games
+// can switch CHR mid-screen just by placing those tiles.
+type MMC2 struct {
+	*board
+
+	mmc4 bool
+
+	chr     [2][2]byte // [table][latch]
+	latch   [2]int
+	prgBank byte
+}
+
+const (
+	latchFD = 0
+	latchFE = 1
+)
+
+func NewMMC2(r rom.ROM) *MMC2 {
+	return &MMC2{board: newBoard(r), latch: [2]int{latchFE, latchFE}}
+}
+
+func NewMMC4(r rom.ROM) *MMC2 {
+	return &MMC2{board: newBoard(r), mmc4: true, latch: [2]int{latchFE, latchFE}}
+}
+
+func (m *MMC2) Attach(n *nes.NES) {
+	m.board.Attach(n)
+	m.updatePRG()
+	m.updateCHR()
+}
+
+func (m *MMC2) Write(address uint16, value byte) {
+	if address < 0xA000 {
+		m.board.Write(address, value)
+		return
+	}
+
+	switch address & 0xF000 {
+	case 0xA000:
+		m.prgBank = value & 0x0F
+		m.updatePRG()
+	case 0xB000:
+		m.chr[0][latchFD] = value & 0x1F
+	case 0xC000:
+		m.chr[0][latchFE] = value & 0x1F
+	case 0xD000:
+		m.chr[1][latchFD] = value & 0x1F
+	case 0xE000:
+		m.chr[1][latchFE] = value & 0x1F
+	case 0xF000:
+		if value&1 == 0 {
+			m.setMirroring(rom.MirrorVertical)
+		} else {
+			m.setMirroring(rom.MirrorHorizontal)
+		}
+	}
+	m.updateCHR()
+}
+
+func (m *MMC2) updatePRG() {
+	if m.mmc4 {
+		m.mapPRG(0x8000, 0x4000, int(m.prgBank))
+		m.mapPRG(0xC000, 0x4000, -1)
+		return
+	}
+
+	m.mapPRG(0x8000, 0x2000, int(m.prgBank))
+	m.mapPRG(0xA000, 0x2000, -3)
+	m.mapPRG(0xC000, 0x2000, -2)
+	m.mapPRG(0xE000, 0x2000, -1)
+}
+
+func (m *MMC2) updateCHR() {
+	m.mapCHR(0x0000, 0x1000, int(m.chr[0][m.latch[0]]))
+	m.mapCHR(0x1000, 0x1000, int(m.chr[1][m.latch[1]]))
+}
+
+func (m *MMC2) PPUAddress(address uint16) {
+	if address >= 0x2000 {
+		return
+	}
+
+	table := int(address >> 12)
+	tile := address & 0x0FF8
+
+	// MMC2 only reacts to the first byte of the high plane for table 0
+	if table == 0 && !m.mmc4 && address&0x0007 != 0 {
+		return
+	}
+
+	switch tile {
+	case 0x0FD8:
+		m.latch[table] = latchFD
+	case 0x0FE8:
+		m.latch[table] = latchFE
+	default:
+		return
+	}
+	m.updateCHR()
+}
@@ -0,0 +1,53 @@
+package mapper
+
+import "testing"
+
+func TestMMC2Latches(t *testing.T) {
+	m := NewMMC2(testCart{mapper: 9, prg: 8, chr: 16}.rom(t))
+	n, p, _ := insert(m)
+
+	m.Write(0xA000, 3)
+	m.Write(0xB000, 2) // Table 0, latch $FD
+	m.Write(0xC000, 3) // Table 0, latch $FE
+	m.Write(0xD000, 4) // Table 1, latch $FD
+	m.Write(0xE000, 5) // Table 1, latch $FE
+
+	if got, want := prgBanks(n), [4]int{3, 13, 14, 15}; got != want {
+		t.Errorf("PRG banks %v, want %v", got, want)
+	}
+
+	steps := []struct {
+		address uint16
+		chr     [8]int
+	}{
+		{0x0000, [8]int{12, 13, 14, 15, 20, 21, 22, 23}}, // Both latches start at $FE
+		{0x0FD8, [8]int{8, 9, 10, 11, 20, 21, 22, 23}},
+		{0x0FEA, [8]int{8, 9, 10, 11, 20, 21, 22, 23}}, // MMC2 table 0 only latches on the first byte
+		{0x1FDD, [8]int{8, 9, 10, 11, 16, 17, 18, 19}},
+		{0x0FE8, [8]int{12, 13, 14, 15, 16, 17, 18, 19}},
+	}
+
+	for _, step := range steps {
+		m.PPUAddress(step.address)
+		if got := chrBanks(p); got != step.chr {
+			t.Errorf("After $%04X: CHR banks %v, want %v", step.address, got, step.chr)
+		}
+	}
+}
+
+func TestMMC4Banks(t *testing.T) {
+	m := NewMMC4(testCart{mapper: 10, prg: 8, chr: 16}.rom(t))
+	n, p, _ := insert(m)
+
+	m.Write(0xA000, 3)
+	m.Write(0xB000, 2)
+	m.Write(0xC000, 3)
+	m.PPUAddress(0x0FDA) // MMC4 latches on any byte of the tile
+
+	if got, want := prgBanks(n), [4]int{6, 7, 14, 15}; got != want {
+		t.Errorf("PRG banks %v, want %v", got, want)
+	}
+	if got := chrBanks(p); got[0] != 8 {
+		t.Errorf("CHR banks %v, want table 0 at bank 8", got)
+	}
+}
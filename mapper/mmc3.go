@@ -0,0 +1,128 @@
+package mapper
+
+import (
+	"github.com/evandigby/nesgo/nes"
+	"github.com/evandigby/nesgo/rom"
+)
+
+// MMC3 (mapper 4, TxROM) has eight bank registers selected through $8000,
+// and a scanline counter clocked by rising edges of PPU A12. With background
+// and sprites in different pattern tables A12 rises once per scanline.
+//
+// The real chip ignores rises after A12 was only briefly low, which filters
+// out the nametable fetches between pattern fetches. We approximate that by
+// counting how many accesses in a row A12 was low for.
+type MMC3 struct {
+	*board
+
+	bankSelect byte
+	banks      [8]byte
+
+	irqLatch   byte
+	irqCounter byte
+	irqReload  bool
+	irqEnabled bool
+
+	a12Low int
+}
+
+const a12Filter = 3
+
+func NewMMC3(r rom.ROM) *MMC3 {
+	return &MMC3{board: newBoard(r)}
+}
+
+func (m *MMC3) Attach(n *nes.NES) {
+	m.board.Attach(n)
+	m.update()
+}
+
+func (m *MMC3) Write(address uint16, value byte) {
+	if address < 0x8000 {
+		m.board.Write(address, value)
+		return
+	}
+
+	even := address&1 == 0
+	switch {
+	case address < 0xA000 && even:
+		m.bankSelect = value
+		m.update()
+	case address < 0xA000:
+		m.banks[m.bankSelect&7] = value
+		m.update()
+	case address < 0xC000 && even:
+		if m.rom.Mirroring() == rom.MirrorFourScreen {
+			return
+		}
+		if value&1 == 0 {
+			m.setMirroring(rom.MirrorVertical)
+		} else {
+			m.setMirroring(rom.MirrorHorizontal)
+		}
+	case address < 0xC000:
+		m.prgRAMDisabled = value&0x80 == 0
+		m.prgRAMReadOnly = value&0x40 != 0
+	case address < 0xE000 && even:
+		m.irqLatch = value
+	case address < 0xE000:
+		m.irqCounter = 0
+		m.irqReload = true
+	case even:
+		m.irqEnabled = false
+		m.setIRQ(false)
+	default:
+		m.irqEnabled = true
+	}
+}
+
+func (m *MMC3) update() {
+	if m.bankSelect&0x40 == 0 {
+		m.mapPRG(0x8000, 0x2000, int(m.banks[6]))
+		m.mapPRG(0xC000, 0x2000, -2)
+	} else {
+		m.mapPRG(0x8000, 0x2000, -2)
+		m.mapPRG(0xC000, 0x2000, int(m.banks[6]))
+	}
+	m.mapPRG(0xA000, 0x2000, int(m.banks[7]))
+	m.mapPRG(0xE000, 0x2000, -1)
+
+	// CHR inversion swaps the 2KB and 1KB halves
+	var invert uint16
+	if m.bankSelect&0x80 != 0 {
+		invert = 0x1000
+	}
+	m.mapCHR(0x0000^invert, 0x400, int(m.banks[0]&0xFE))
+	m.mapCHR(0x0400^invert, 0x400, int(m.banks[0]|0x01))
+	m.mapCHR(0x0800^invert, 0x400, int(m.banks[1]&0xFE))
+	m.mapCHR(0x0C00^invert, 0x400, int(m.banks[1]|0x01))
+	m.mapCHR(0x1000^invert, 0x400, int(m.banks[2]))
+	m.mapCHR(0x1400^invert, 0x400, int(m.banks[3]))
+	m.mapCHR(0x1800^invert, 0x400, int(m.banks[4]))
+	m.mapCHR(0x1C00^invert, 0x400, int(m.banks[5]))
+}
+
+func (m *MMC3) PPUAddress(address uint16) {
+	if address&0x1000 == 0 {
+		m.a12Low++
+		return
+	}
+
+	if m.a12Low >= a12Filter {
+		m.clockScanline()
+	}
+	m.a12Low = 0
+}
+
+func (m *MMC3) clockScanline() {
+	if m.irqCounter == 0 || m.irqReload {
+		m.irqCounter = m.irqLatch
+		m.irqReload = false
+	} else {
+		m.irqCounter--
+	}
+
+	if m.irqCounter == 0 && m.irqEnabled {
+		m.setIRQ(true)
+	}
+}
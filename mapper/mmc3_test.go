@@ -0,0 +1,151 @@
+package mapper
+
+import (
+	"testing"
+
+	"github.com/evandigby/nesgo/rom"
+)
+
+func TestMMC3Banks(t *testing.T) {
+	registers := []write{
+		{0x8000, 0}, {0x8001, 8},
+		{0x8000, 1}, {0x8001, 10},
+		{0x8000, 2}, {0x8001, 20},
+		{0x8000, 3}, {0x8001, 21},
+		{0x8000, 4}, {0x8001, 22},
+		{0x8000, 5}, {0x8001, 23},
+		{0x8000, 6}, {0x8001, 3},
+		{0x8000, 7}, {0x8001, 4},
+	}
+
+	tests := []struct {
+		name       string
+		bankSelect byte
+		prg        [4]int
+		chr        [8]int
+	}{
+		{"normal", 0x00, [4]int{3, 4, 14, 15}, [8]int{8, 9, 10, 11, 20, 21, 22, 23}},
+		{"PRG inverted", 0x40, [4]int{14, 4, 3, 15}, [8]int{8, 9, 10, 11, 20, 21, 22, 23}},
+		{"CHR inverted", 0x80, [4]int{3, 4, 14, 15}, [8]int{20, 21, 22, 23, 8, 9, 10, 11}},
+	}
+
+	for _, test := range tests {
+		m := NewMMC3(testCart{mapper: 4, prg: 8, chr: 16}.rom(t))
+		n, p, _ := insert(m)
+		for _, w := range registers {
+			m.Write(w.address, w.value)
+		}
+		m.Write(0x8000, test.bankSelect)
+
+		if got := prgBanks(n); got != test.prg {
+			t.Errorf("%v: PRG banks %v, want %v", test.name, got, test.prg)
+		}
+		if got := chrBanks(p); got != test.chr {
+			t.Errorf("%v: CHR banks %v, want %v", test.name, got, test.chr)
+		}
+	}
+}
+
+func TestMMC3Mirroring(t *testing.T) {
+	m := NewMMC3(testCart{mapper: 4, prg: 2, chr: 1}.rom(t))
+	_, p, _ := insert(m)
+
+	m.Write(0xA000, 0)
+	if p.mirroring != rom.MirrorVertical {
+		t.Errorf("$A000=0: mirroring %v, want vertical", p.mirroring)
+	}
+	m.Write(0xA000, 1)
+	if p.mirroring != rom.MirrorHorizontal {
+		t.Errorf("$A000=1: mirroring %v, want horizontal", p.mirroring)
+	}
+}
+
+func TestMMC3PRGRAMProtect(t *testing.T) {
+	m := NewMMC3(testCart{mapper: 4, prg: 2, chr: 1}.rom(t))
+	insert(m)
+
+	m.Write(0xA001, 0x80)
+	m.Write(0x6000, 0x42)
+	m.Write(0xA001, 0xC0)
+	m.Write(0x6000, 0x99)
+	if got := m.Read(0x6000, false); got != 0x42 {
+		t.Errorf("Write protected PRG-RAM read $%02X, want $42", got)
+	}
+
+	m.Write(0xA001, 0x00)
+	if got := m.Read(0x6000, false); got != 0x60 {
+		t.Errorf("Disabled PRG-RAM read $%02X, want open bus $60", got)
+	}
+}
+
+// scanline makes the A12 pattern of one rendered line with the background at
+// $0000 and sprites at $1000: a run of low fetches, then a rise.
+func scanline(m *MMC3) {
+	for i := 0; i < 8; i++ {
+		m.PPUAddress(0x0000)
+	}
+	m.PPUAddress(0x1000)
+}
+
+func TestMMC3IRQCounter(t *testing.T) {
+	m := NewMMC3(testCart{mapper: 4, prg: 2, chr: 1}.rom(t))
+	_, _, irq := insert(m)
+
+	m.Write(0xC000, 2) // Latch
+	m.Write(0xC001, 0) // Reload
+	m.Write(0xE001, 0) // Enable
+
+	// Reload to 2, then count down to 0, then reload and count again
+	want := []bool{false, false, true, false, false, true}
+	for i, w := range want {
+		scanline(m)
+		if irq.irq != w {
+			t.Errorf("Scanline %v: IRQ %v, want %v", i, irq.irq, w)
+		}
+		if irq.irq {
+			m.Write(0xE000, 0) // Acknowledge
+			m.Write(0xE001, 0)
+		}
+	}
+}
+
+func TestMMC3IRQDisabled(t *testing.T) {
+	m := NewMMC3(testCart{mapper: 4, prg: 2, chr: 1}.rom(t))
+	_, _, irq := insert(m)
+
+	m.Write(0xC000, 1)
+	m.Write(0xC001, 0)
+	m.Write(0xE000, 0)
+
+	for i := 0; i < 4; i++ {
+		scanline(m)
+	}
+	if irq.irq {
+		t.Errorf("IRQ asserted while disabled")
+	}
+}
+
+// A12 rising again after only a short time low, like between the two pattern
+// fetches of a tile, doesn't clock the counter.
+func TestMMC3A12Filter(t *testing.T) {
+	m := NewMMC3(testCart{mapper: 4, prg: 2, chr: 1}.rom(t))
+	_, _, irq := insert(m)
+
+	m.Write(0xC000, 1)
+	m.Write(0xC001, 0)
+	m.Write(0xE001, 0)
+
+	for i := 0; i < 16; i++ {
+		m.PPUAddress(0x0000)
+		m.PPUAddress(0x1000)
+	}
+	if irq.irq {
+		t.Fatalf("IRQ asserted by filtered A12 rises")
+	}
+
+	scanline(m) // Reload to 1
+	scanline(m) // 0
+	if !irq.irq {
+		t.Errorf("IRQ not asserted after two scanlines")
+	}
+}
@@ -0,0 +1,417 @@
+package mapper
+
+import (
+	"github.com/evandigby/nesgo/nes"
+	"github.com/evandigby/nesgo/rom"
+)
+
+const (
+	mmc5PRGRAMSize = 0x10000
+	mmc5ExRAMSize  = 0x400
+)
+
+// ExRAM modes selected through $5104
+const (
+	exRAMNametable = iota
+	exRAMAttributes
+	exRAMReadWrite
+	exRAMReadOnly
+)
+
+// MMC5 (mapper 5, ExROM) is the most capable Nintendo board. Besides PRG and
+// CHR banking in several granularities, it has 1KB of ExRAM that can be used
+// as a nametable or to give every background tile its own palette and CHR
+// bank, a fill mode nametable, a vertical split screen, a hardware
+// multiplier, and a scanline IRQ.
+//
+// The MMC5 follows rendering by watching the PPU's fetches. Two CHR register
+// sets exist so 8x16 sprites (set A) and the background (set B) can use
+// different banks.
+type MMC5 struct {
+	*board
+
+	prgMode    byte
+	prgBanks   [5]byte // $5113-$5117
+	ramProtect [2]byte
+
+	chrMode      byte
+	chrA         [8]uint16
+	chrB         [4]uint16
+	chrUpper     byte
+	lastB        bool
+	sprites8x16  bool
+	exRAMMode    byte
+	exRAM        []*byte
+	fill         []*byte
+	fillTile     byte
+	fillAttr     byte
+	ntMapping    byte
+	multiplicand byte
+	multiplier   byte
+
+	splitMode   byte
+	splitScroll byte
+	splitBank   byte
+	splitY      int
+
+	irqCompare byte
+	irqEnabled bool
+	irqPending bool
+	inFrame    bool
+	line       int
+
+	lastFetch nes.PPUFetch
+	tile      int
+	exAttr    byte
+	inSplit   bool
+	splitTile byte
+	splitAttr byte
+}
+
+func NewMMC5(r rom.ROM) *MMC5 {
+	m := &MMC5{board: newBoard(r), prgMode: 3, exRAM: makeRAM(mmc5ExRAMSize)}
+	m.prgRAM = makeRAM(mmc5PRGRAMSize)
+	m.prgBanks[4] = 0xFF
+
+	// Fill mode is a nametable where every tile and attribute is the same
+	m.fill = make([]*byte, 0x400)
+	for i := range m.fill {
+		if i < 0x3C0 {
+			m.fill[i] = &m.fillTile
+		} else {
+			m.fill[i] = &m.fillAttr
+		}
+	}
+
+	return m
+}
+
+func (m *MMC5) Attach(n *nes.NES) {
+	m.board.Attach(n)
+	m.updatePRG()
+	m.updateCHR()
+}
+
+func (m *MMC5) Read(address uint16, debug bool) byte {
+	switch {
+	case address == 0x5204:
+		val := byte(0)
+		if m.irqPending {
+			val |= 0x80
+		}
+		if m.inFrame {
+			val |= 0x40
+		}
+		if !debug {
+			m.irqPending = false
+			m.setIRQ(false)
+		}
+		return val
+	case address == 0x5205:
+		return byte(uint16(m.multiplicand) * uint16(m.multiplier))
+	case address == 0x5206:
+		return byte((uint16(m.multiplicand) * uint16(m.multiplier)) >> 8)
+	case address >= 0x5C00 && address < 0x6000:
+		if m.exRAMMode < exRAMReadWrite {
+			return byte(address >> 8) // Open bus
+		}
+		return *m.exRAM[address-0x5C00]
+	}
+
+	return m.board.Read(address, debug)
+}
+
+func (m *MMC5) Write(address uint16, value byte) {
+	switch {
+	case address == 0x5100:
+		m.prgMode = value & 3
+		m.updatePRG()
+	case address == 0x5101:
+		m.chrMode = value & 3
+		m.updateCHR()
+	case address == 0x5102 || address == 0x5103:
+		m.ramProtect[address-0x5102] = value & 3
+	case address == 0x5104:
+		m.exRAMMode = value & 3
+	case address == 0x5105:
+		m.ntMapping = value
+		m.updateNametables()
+	case address == 0x5106:
+		m.fillTile = value
+	case address == 0x5107:
+		c := value & 3
+		m.fillAttr = c | c<<2 | c<<4 | c<<6
+	case address >= 0x5113 && address <= 0x5117:
+		m.prgBanks[address-0x5113] = value
+		m.updatePRG()
+	case address >= 0x5120 && address <= 0x5127:
+		m.chrA[address-0x5120] = uint16(value) | uint16(m.chrUpper)<<8
+		m.lastB = false
+		m.updateCHR()
+	case address >= 0x5128 && address <= 0x512B:
+		m.chrB[address-0x5128] = uint16(value) | uint16(m.chrUpper)<<8
+		m.lastB = true
+		m.updateCHR()
+	case address == 0x5130:
+		m.chrUpper = value & 3
+	case address == 0x5200:
+		m.splitMode = value
+	case address == 0x5201:
+		m.splitScroll = value
+	case address == 0x5202:
+		m.splitBank = value
+	case address == 0x5203:
+		m.irqCompare = value
+	case address == 0x5204:
+		m.irqEnabled = value&0x80 != 0
+		m.setIRQ(m.irqEnabled && m.irqPending)
+	case address == 0x5205:
+		m.multiplicand = value
+	case address == 0x5206:
+		m.multiplier = value
+	case address >= 0x5C00 && address < 0x6000:
+		m.writeExRAM(address-0x5C00, value)
+	case address >= prgRAMBase:
+		if m.ramWritable() && m.isRAM(address) {
+			*m.nes.Memory[address] = value
+		}
+	}
+}
+
+func (m *MMC5) writeExRAM(offset uint16, value byte) {
+	switch m.exRAMMode {
+	case exRAMNametable, exRAMAttributes:
+		// Only writable while rendering, otherwise 0 is written
+		if !m.inFrame {
+			value = 0
+		}
+	case exRAMReadOnly:
+		return
+	}
+	*m.exRAM[offset] = value
+}
+
+func (m *MMC5) ramWritable() bool {
+	return m.ramProtect[0] == 2 && m.ramProtect[1] == 1
+}
+
+// isRAM reports if PRG-RAM is mapped at the address
+func (m *MMC5) isRAM(address uint16) bool {
+	if address < 0x8000 {
+		return true
+	}
+
+	var reg byte
+	switch m.prgMode {
+	case 0:
+		return false
+	case 1:
+		if address >= 0xC000 {
+			return false
+		}
+		reg = m.prgBanks[2]
+	case 2:
+		if address >= 0xE000 {
+			return false
+		}
+		reg = m.prgBanks[2+(address-0x8000)/0x4000]
+	case 3:
+		if address >= 0xE000 {
+			return false
+		}
+		reg = m.prgBanks[1+(address-0x8000)/0x2000]
+	}
+
+	return reg&0x80 == 0
+}
+
+// mapPRG8 maps an 8KB bank of PRG-ROM, or PRG-RAM when bit 7 is clear
+func (m *MMC5) mapPRG8(address uint16, reg byte, romOnly bool) {
+	if romOnly || reg&0x80 != 0 {
+		m.mapPRG(address, 0x2000, int(reg&0x7F))
+	} else {
+		m.nes.MapPRG(address, bank(m.prgRAM, 0x2000, int(reg&0x07)))
+	}
+}
+
+func (m *MMC5) updatePRG() {
+	m.mapPRG8(0x6000, m.prgBanks[0]&0x07, false)
+
+	switch m.prgMode {
+	case 0:
+		m.mapPRG(0x8000, 0x8000, int(m.prgBanks[4]&0x7F)>>2)
+	case 1:
+		m.mapPRG8(0x8000, m.prgBanks[2]&0xFE, false)
+		m.mapPRG8(0xA000, m.prgBanks[2]|0x01, false)
+		m.mapPRG(0xC000, 0x4000, int(m.prgBanks[4]&0x7F)>>1)
+	case 2:
+		m.mapPRG8(0x8000, m.prgBanks[2]&0xFE, false)
+		m.mapPRG8(0xA000, m.prgBanks[2]|0x01, false)
+		m.mapPRG8(0xC000, m.prgBanks[3], false)
+		m.mapPRG8(0xE000, m.prgBanks[4], true)
+	case 3:
+		m.mapPRG8(0x8000, m.prgBanks[1], false)
+		m.mapPRG8(0xA000, m.prgBanks[2], false)
+		m.mapPRG8(0xC000, m.prgBanks[3], false)
+		m.mapPRG8(0xE000, m.prgBanks[4], true)
+	}
+}
+
+// chrBank returns the 1KB CHR bank for a 1KB slot of the pattern tables.
+// Registers are grouped by the CHR mode's bank size, and the last register
+// of each group is the one used. Set B only covers 4KB, which repeats.
+func (m *MMC5) chrBank(slot int, b bool) int {
+	size := 8 >> m.chrMode
+	if !b {
+		return int(m.chrA[(slot/size)*size+size-1])*size + slot%size
+	}
+
+	groups := size
+	if groups > 4 {
+		groups = 4
+	}
+	reg := m.chrB[((slot%4)/groups)*groups+groups-1]
+	return int(reg)*size + slot%size
+}
+
+func (m *MMC5) updateCHR() {
+	// 8x16 sprites use set A, leaving set B for the background. Otherwise
+	// the last set written is used for everything.
+	b := m.lastB && !m.sprites8x16
+	for slot := 0; slot < 8; slot++ {
+		m.mapCHR(uint16(slot)*0x400, 0x400, m.chrBank(slot, b))
+	}
+}
+
+func (m *MMC5) updateNametables() {
+	for table := 0; table < 4; table++ {
+		switch (m.ntMapping >> uint(table*2)) & 3 {
+		case 0:
+			m.nes.PPU.MapNametable(table, m.nes.PPU.Nametable(0))
+		case 1:
+			m.nes.PPU.MapNametable(table, m.nes.PPU.Nametable(1))
+		case 2:
+			m.nes.PPU.MapNametable(table, m.exRAM)
+		case 3:
+			m.nes.PPU.MapNametable(table, m.fill)
+		}
+	}
+}
+
+func (m *MMC5) CPUWrite(address uint16, value byte) {
+	switch address {
+	case 0x2000:
+		sprites8x16 := value&0x20 != 0
+		if sprites8x16 != m.sprites8x16 {
+			m.sprites8x16 = sprites8x16
+			m.updateCHR()
+		}
+	case 0x2001:
+		if value&0x18 == 0 {
+			m.inFrame = false
+		}
+	}
+}
+
+// scanline is called as the PPU starts fetching the first tiles of a line
+func (m *MMC5) scanline() {
+	m.tile = 0
+
+	if !m.inFrame {
+		m.inFrame = true
+		m.line = 0
+		m.splitY = int(m.splitScroll)
+		m.irqPending = false
+		m.setIRQ(false)
+		return
+	}
+
+	m.line++
+	m.splitY++
+	if m.splitY >= 240 {
+		m.splitY -= 240
+	}
+
+	if m.line >= 240 {
+		m.inFrame = false
+		return
+	}
+
+	if m.irqCompare != 0 && m.line == int(m.irqCompare) {
+		m.irqPending = true
+		if m.irqEnabled {
+			m.setIRQ(true)
+		}
+	}
+}
+
+func (m *MMC5) splitActive(tile int) bool {
+	if m.splitMode&0x80 == 0 || m.exRAMMode >= exRAMReadWrite {
+		return false
+	}
+
+	threshold := int(m.splitMode & 0x1F)
+	if m.splitMode&0x40 != 0 {
+		return tile >= threshold
+	}
+	return tile < threshold
+}
+
+func (m *MMC5) Fetch(kind nes.PPUFetch, address uint16, value byte) byte {
+	last := m.lastFetch
+	m.lastFetch = kind
+
+	switch kind {
+	case nes.FetchNametable:
+		if last == nes.FetchSprite {
+			m.scanline()
+		}
+
+		// Tiles 0 and 1 are prefetched at the end of the previous line
+		column := m.tile % 34
+		m.tile++
+
+		m.inSplit = m.splitActive(column)
+		if m.inSplit {
+			row := m.splitY / 8
+			col := column % 32
+			m.splitTile = *m.exRAM[row*32+col]
+
+			at := *m.exRAM[0x3C0+(row/4)*8+col/4]
+			shift := uint((row&2)<<1 | (col & 2))
+			m.splitAttr = (at >> shift) & 3
+			return m.splitTile
+		}
+
+		if m.exRAMMode == exRAMAttributes {
+			m.exAttr = *m.exRAM[address&0x3FF]
+		}
+	case nes.FetchAttribute:
+		if m.inSplit {
+			c := m.splitAttr
+			return c | c<<2 | c<<4 | c<<6
+		}
+		if m.exRAMMode == exRAMAttributes {
+			c := m.exAttr >> 6
+			return c | c<<2 | c<<4 | c<<6
+		}
+	case nes.FetchBackground:
+		if len(m.chr) == 0 {
+			break
+		}
+		if m.inSplit {
+			offset := int(m.splitTile)*16 + int(address&8) + m.splitY%8
+			return *bank(m.chr, 0x1000, int(m.splitBank))[offset]
+		}
+		if m.exRAMMode == exRAMAttributes {
+			b := int(m.exAttr&0x3F) | int(m.chrUpper)<<6
+			return *bank(m.chr, 0x1000, b)[address&0xFFF]
+		}
+		if m.sprites8x16 {
+			slot := int(address >> 10)
+			return *bank(m.chr, 0x400, m.chrBank(slot, true))[address&0x3FF]
+		}
+	}
+
+	return value
+}
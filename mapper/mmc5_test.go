@@ -0,0 +1,113 @@
+package mapper
+
+import (
+	"testing"
+
+	"github.com/evandigby/nesgo/nes"
+)
+
+func TestMMC5PRGModes(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []write
+		prg    [4]int
+	}{
+		{"mode 0, 32KB", []write{{0x5100, 0}, {0x5117, 0x87}}, [4]int{4, 5, 6, 7}},
+		{"mode 1, 16KB", []write{{0x5100, 1}, {0x5115, 0x86}, {0x5117, 0x8F}}, [4]int{6, 7, 14, 15}},
+		{"mode 2, 16KB+8KB", []write{{0x5100, 2}, {0x5115, 0x84}, {0x5116, 0x89}, {0x5117, 0x8C}}, [4]int{4, 5, 9, 12}},
+		{"mode 3, 8KB", []write{{0x5100, 3}, {0x5114, 0x83}, {0x5115, 0x84}, {0x5116, 0x85}}, [4]int{3, 4, 5, 15}},
+	}
+
+	for _, test := range tests {
+		m := NewMMC5(testCart{mapper: 5, prg: 8, chr: 8}.rom(t))
+		n, _, _ := insert(m)
+		for _, w := range test.writes {
+			m.Write(w.address, w.value)
+		}
+
+		if got := prgBanks(n); got != test.prg {
+			t.Errorf("%v: PRG banks %v, want %v", test.name, got, test.prg)
+		}
+	}
+}
+
+func TestMMC5PRGRAMBank(t *testing.T) {
+	m := NewMMC5(testCart{mapper: 5, prg: 8, chr: 8}.rom(t))
+	n, _, _ := insert(m)
+
+	m.Write(0x5102, 2)
+	m.Write(0x5103, 1)
+	m.Write(0x5114, 0x01) // PRG-RAM bank 1 at $8000
+	m.Write(0x8000, 0x42)
+
+	if got := *n.Memory[0x8000]; got != 0x42 {
+		t.Errorf("PRG-RAM at $8000 read $%02X, want $42", got)
+	}
+
+	m.Write(0x5113, 0x01) // Same bank at $6000
+	if got := *n.Memory[0x6000]; got != 0x42 {
+		t.Errorf("PRG-RAM at $6000 read $%02X, want $42", got)
+	}
+}
+
+func TestMMC5Multiplier(t *testing.T) {
+	m := NewMMC5(testCart{mapper: 5, prg: 2, chr: 1}.rom(t))
+	insert(m)
+
+	m.Write(0x5205, 200)
+	m.Write(0x5206, 100)
+	if lo, hi := m.Read(0x5205, false), m.Read(0x5206, false); lo != 0x20 || hi != 0x4E {
+		t.Errorf("200 * 100 = $%02X%02X, want $4E20", hi, lo)
+	}
+}
+
+// mmc5Scanline makes the fetches the MMC5 sees at the start of a line: the
+// last sprite fetch of the previous line, then a nametable fetch.
+func mmc5Scanline(m *MMC5) {
+	m.Fetch(nes.FetchSprite, 0x1000, 0)
+	m.Fetch(nes.FetchNametable, 0x2000, 0)
+}
+
+func TestMMC5ScanlineIRQ(t *testing.T) {
+	m := NewMMC5(testCart{mapper: 5, prg: 2, chr: 1}.rom(t))
+	_, _, irq := insert(m)
+
+	m.Write(0x5203, 3)
+	m.Write(0x5204, 0x80)
+
+	for line := 0; line < 3; line++ {
+		mmc5Scanline(m)
+		if irq.irq {
+			t.Fatalf("IRQ asserted on line %v, want 3", line)
+		}
+	}
+	mmc5Scanline(m)
+	if !irq.irq {
+		t.Fatalf("IRQ not asserted on line 3")
+	}
+
+	if got := m.Read(0x5204, false); got != 0xC0 {
+		t.Errorf("$5204 read $%02X, want $C0 for pending and in frame", got)
+	}
+	if irq.irq {
+		t.Errorf("Reading $5204 didn't acknowledge the IRQ")
+	}
+}
+
+func TestMMC5FillMode(t *testing.T) {
+	m := NewMMC5(testCart{mapper: 5, prg: 2, chr: 1}.rom(t))
+	_, p, _ := insert(m)
+
+	m.Write(0x5106, 0x24)
+	m.Write(0x5107, 0x02)
+	m.Write(0x5105, 0xFF) // Every nametable is the fill nametable
+
+	for table := 0; table < 4; table++ {
+		if got := *p.tables[table][0]; got != 0x24 {
+			t.Errorf("Nametable %v tile $%02X, want $24", table, got)
+		}
+		if got := *p.tables[table][0x3C0]; got != 0xAA {
+			t.Errorf("Nametable %v attribute $%02X, want $AA", table, got)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package mapper
+
+import (
+	"github.com/evandigby/nesgo/nes"
+	"github.com/evandigby/nesgo/rom"
+)
+
+const namcoSoundRAMSize = 0x80
+
+// Namco163 (mapper 19) covers the Namco 129 and 163. Any of the pattern
+// table banks and all four nametables can be pointed at either CHR-ROM or the
+// console's nametable RAM, and a 15 bit counter clocked by the CPU drives the
+// IRQ. The 163's wavetable sound shares 128 bytes of RAM with the CPU.
+type Namco163 struct {
+	*board
+
+	Audio ExpansionAudio
+
+	chrBanks   [8]byte
+	nametables [4]byte
+	prg        [3]byte
+	chrRAMOff  [2]bool // pattern table halves that can't select nametable RAM
+	ramProtect byte
+
+	soundRAM     []byte
+	soundAddress byte
+
+	counter uint16
+	enabled bool
+}
+
+func NewNamco163(r rom.ROM) *Namco163 {
+	m := &Namco163{board: newBoard(r), soundRAM: make([]byte, namcoSoundRAMSize)}
+
+	// Start out with the nametables the header asks for
+	m.nametables = [4]byte{0xE0, 0xE1, 0xE0, 0xE1}
+	if r.Mirroring() == rom.MirrorHorizontal {
+		m.nametables = [4]byte{0xE0, 0xE0, 0xE1, 0xE1}
+	}
+
+	return m
+}
+
+func (m *Namco163) Attach(n *nes.NES) {
+	m.board.Attach(n)
+	m.update()
+}
+
+// CPUCycles counts up once per CPU cycle. The counter stops at $7FFF, which
+// is also when the IRQ fires.
+func (m *Namco163) CPUCycles(cycles int) {
+	if !m.enabled || m.counter == 0x7FFF {
+		return
+	}
+
+	m.counter += uint16(cycles)
+	if m.counter >= 0x7FFF {
+		m.counter = 0x7FFF
+		m.setIRQ(true)
+	}
+}
+
+func (m *Namco163) Read(address uint16, debug bool) byte {
+	switch address & 0xF800 {
+	case 0x4800:
+		val := m.soundRAM[m.soundAddress&0x7F]
+		if !debug {
+			m.incrementSoundAddress()
+		}
+		return val
+	case 0x5000:
+		return byte(m.counter)
+	case 0x5800:
+		val := byte(m.counter >> 8)
+		if m.enabled {
+			val |= 0x80
+		}
+		return val
+	}
+
+	return m.board.Read(address, debug)
+}
+
+func (m *Namco163) Write(address uint16, value byte) {
+	switch {
+	case address >= 0x4800 && address < 0x5000:
+		m.soundRAM[m.soundAddress&0x7F] = value
+		if m.Audio != nil {
+			m.Audio.WriteAudio(uint16(m.soundAddress&0x7F), value)
+		}
+		m.incrementSoundAddress()
+		return
+	case address >= 0x5000 && address < 0x5800:
+		m.counter = (m.counter & 0x7F00) | uint16(value)
+		m.setIRQ(false)
+		return
+	case address >= 0x5800 && address < 0x6000:
+		m.counter = (m.counter & 0x00FF) | uint16(value&0x7F)<<8
+		m.enabled = value&0x80 != 0
+		m.setIRQ(false)
+		return
+	case address >= prgRAMBase && address < 0x8000:
+		if m.writable(address) {
+			*m.nes.Memory[address] = value
+		}
+		return
+	case address < 0x8000:
+		return
+	}
+
+	switch reg := (address - 0x8000) / 0x800; {
+	case reg < 8:
+		m.chrBanks[reg] = value
+	case reg < 12:
+		m.nametables[reg-8] = value
+	case reg == 12:
+		m.prg[0] = value & 0x3F
+	case reg == 13:
+		m.prg[1] = value & 0x3F
+		m.chrRAMOff[0] = value&0x40 != 0
+		m.chrRAMOff[1] = value&0x80 != 0
+	case reg == 14:
+		m.prg[2] = value & 0x3F
+	case reg == 15:
+		m.ramProtect = value
+		m.soundAddress = value
+		return
+	}
+
+	m.update()
+}
+
+// writable reports whether a 2KB window of PRG-RAM is unprotected. Writes
+// need the enable pattern $4x in $F800, and the low bits protect each window.
+func (m *Namco163) writable(address uint16) bool {
+	if m.ramProtect&0xF0 != 0x40 {
+		return false
+	}
+	window := uint((address - prgRAMBase) / 0x800)
+	return m.ramProtect&(1<<window) == 0
+}
+
+// incrementSoundAddress advances the sound RAM address after an access when
+// auto increment (bit 7) is set.
+func (m *Namco163) incrementSoundAddress() {
+	if m.soundAddress&0x80 != 0 {
+		m.soundAddress = 0x80 | (m.soundAddress+1)&0x7F
+	}
+}
+
+// NametableIsROM reports whether a nametable is pointed at CHR-ROM, which
+// can't be written through PPUDATA
+func (m *Namco163) NametableIsROM(table int) bool {
+	return m.nametables[table] < 0xE0 && !m.chrRAM
+}
+
+// page returns the 1KB page a CHR or nametable register selects. Values $E0
+// and up select a page of nametable RAM instead of CHR-ROM.
+func (m *Namco163) page(value byte) []*byte {
+	if value >= 0xE0 {
+		return m.nes.PPU.Nametable(int(value & 1))
+	}
+	return bank(m.board.chr, 0x400, int(value))
+}
+
+func (m *Namco163) update() {
+	m.mapPRG(0x8000, 0x2000, int(m.prg[0]))
+	m.mapPRG(0xA000, 0x2000, int(m.prg[1]))
+	m.mapPRG(0xC000, 0x2000, int(m.prg[2]))
+	m.mapPRG(0xE000, 0x2000, -1)
+
+	patterns := m.nes.PPU.PatternTables()
+	for i, b := range m.chrBanks {
+		if m.chrRAMOff[i/4] && b >= 0xE0 {
+			m.mapCHR(uint16(i)*0x400, 0x400, int(b))
+			continue
+		}
+		copy(patterns[i*0x400:], m.page(b))
+	}
+
+	for table, b := range m.nametables {
+		if page := m.page(b); len(page) > 0 {
+			m.nes.PPU.MapNametable(table, page)
+		}
+	}
+}
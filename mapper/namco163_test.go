@@ -0,0 +1,99 @@
+package mapper
+
+import "testing"
+
+func TestNamco163Banks(t *testing.T) {
+	m := NewNamco163(testCart{mapper: 19, prg: 8, chr: 8}.rom(t))
+	n, p, _ := insert(m)
+
+	m.Write(0xE000, 3)
+	m.Write(0xE800, 4)
+	m.Write(0xF000, 5)
+	for i := 0; i < 8; i++ {
+		m.Write(0x8000+uint16(i)*0x800, byte(8*i+1))
+	}
+
+	if got, want := prgBanks(n), [4]int{3, 4, 5, 15}; got != want {
+		t.Errorf("PRG banks %v, want %v", got, want)
+	}
+	if got, want := chrBanks(p), [8]int{1, 9, 17, 25, 33, 41, 49, 57}; got != want {
+		t.Errorf("CHR banks %v, want %v", got, want)
+	}
+}
+
+func TestNamco163Nametables(t *testing.T) {
+	m := NewNamco163(testCart{mapper: 19, prg: 2, chr: 8}.rom(t))
+	_, p, _ := insert(m)
+
+	m.Write(0xC000, 0xE1) // Nametable 0 from nametable RAM page 1
+	m.Write(0xC800, 0x05) // Nametable 1 from CHR-ROM bank 5
+
+	if p.tables[0][0] != p.Nametable(1)[0] {
+		t.Errorf("Nametable 0 isn't nametable RAM page 1")
+	}
+	if got := *p.tables[1][0]; got != 5 {
+		t.Errorf("Nametable 1 is CHR bank %v, want 5", got)
+	}
+}
+
+func TestNamco163IRQ(t *testing.T) {
+	m := NewNamco163(testCart{mapper: 19, prg: 2, chr: 1}.rom(t))
+	_, _, irq := insert(m)
+
+	m.Write(0x5000, 0xFD)
+	m.Write(0x5800, 0xFF) // $7FFD, enabled
+
+	if got := irqCycle(m, irq, 10); got != 2 {
+		t.Errorf("IRQ on cycle %v, want 2", got)
+	}
+	if hi, lo := m.Read(0x5800, false), m.Read(0x5000, false); hi != 0xFF || lo != 0xFF {
+		t.Errorf("Counter reads $%02X%02X, want it stopped at $7FFF and enabled", hi, lo)
+	}
+
+	m.Write(0x5800, 0x00)
+	if irq.irq {
+		t.Errorf("IRQ still asserted after writing the counter")
+	}
+}
+
+func TestNamco163SoundRAM(t *testing.T) {
+	m := NewNamco163(testCart{mapper: 19, prg: 2, chr: 1}.rom(t))
+	insert(m)
+
+	m.Write(0xF800, 0x80|0x10) // Auto increment from $10
+	m.Write(0x4800, 0x11)
+	m.Write(0x4800, 0x22)
+
+	m.Write(0xF800, 0x80|0x10)
+	if a, b := m.Read(0x4800, false), m.Read(0x4800, false); a != 0x11 || b != 0x22 {
+		t.Errorf("Sound RAM read $%02X $%02X, want $11 $22", a, b)
+	}
+}
+
+func TestNamco163IRQWritesDontRemap(t *testing.T) {
+	m := NewNamco163(testCart{mapper: 19, prg: 2, chr: 1}.rom(t))
+	n, _, _ := insert(m)
+	n.Remapped()
+
+	m.Write(0x5000, 0x00)
+	m.Write(0x5800, 0x80)
+	m.Write(0xF800, 0x40)
+	m.Write(0x4800, 0x11)
+	if start, end, ok := n.Remapped(); ok {
+		t.Errorf("IRQ, sound and protect writes remapped $%04X-$%04X", start, end)
+	}
+}
+
+func TestNamco163ROMNametables(t *testing.T) {
+	m := NewNamco163(testCart{mapper: 19, prg: 2, chr: 8}.rom(t))
+	insert(m)
+
+	m.Write(0xC000, 0xE0)
+	m.Write(0xC800, 0x05)
+	if m.NametableIsROM(0) {
+		t.Errorf("Nametable 0 in nametable RAM reported as ROM")
+	}
+	if !m.NametableIsROM(1) {
+		t.Errorf("Nametable 1 in CHR-ROM reported as writable")
+	}
+}
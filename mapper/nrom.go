@@ -0,0 +1,23 @@
+package mapper
+
+import (
+	"github.com/evandigby/nesgo/nes"
+	"github.com/evandigby/nesgo/rom"
+)
+
+// NROM (mapper 0) has no bank switching. 16KB boards mirror their only PRG
+// page into $C000.
+type NROM struct {
+	*board
+}
+
+func NewNROM(r rom.ROM) *NROM {
+	return &NROM{newBoard(r)}
+}
+
+func (m *NROM) Attach(n *nes.NES) {
+	m.board.Attach(n)
+	m.mapPRG(0x8000, 0x4000, 0)
+	m.mapPRG(0xC000, 0x4000, -1)
+	m.mapCHR(0x0000, 0x2000, 0)
+}
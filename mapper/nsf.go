@@ -0,0 +1,209 @@
+package mapper
+
+import (
+	"github.com/evandigby/nesgo/cpu"
+	"github.com/evandigby/nesgo/nes"
+	"github.com/evandigby/nesgo/rom"
+)
+
+// Where the player's driver lives, and its registers
+const (
+	nsfDriverBase  = 0x4100
+	nsfDriverNMI   = 0x4120
+	nsfTrackReg    = 0x4180 // Reading it resets the console for a new track
+	nsfRegionReg   = 0x4181
+	nsfInitDoneReg = 0x4182
+	nsfPlayDoneReg = 0x4183
+	nsfChangeReg   = 0x4184
+)
+
+// CPU cycles per microsecond
+const (
+	nsfNTSCClock = 1.789773
+	nsfPALClock  = 1.662607
+)
+
+// NSF plays NSF music rips. There's no game to run the sound driver, so a
+// small driver of our own takes its place: on reset it calls the rip's init
+// routine for the selected track, then idles while the player raises an NMI
+// at the rip's play rate to call the play routine.
+//
+// There's no APU yet, so nothing is heard: the rip's writes to the sound
+// registers only land in memory.
+//
+// $8000-$FFFF is split into eight 4KB banks, switched through $5FF8-$5FFF.
+type NSF struct {
+	*board
+
+	nsf    *rom.NSF
+	driver []*byte
+	banks  [8]byte
+
+	track   int
+	changed bool
+
+	period  int
+	elapsed int
+	started bool
+	playing bool
+}
+
+func NewNSF(r *rom.NSF) *NSF {
+	m := &NSF{board: newBoard(r), nsf: r, track: r.StartSong()}
+
+	initAddr, playAddr := r.InitAddress(), r.PlayAddress()
+	driver := []byte{
+		0x78,       // SEI
+		0xD8,       // CLD
+		0xA2, 0xFF, // LDX #$FF
+		0x9A,             // TXS
+		0xAD, 0x80, 0x41, // LDA nsfTrackReg
+		0xAE, 0x81, 0x41, // LDX nsfRegionReg
+		0x20, byte(initAddr), byte(initAddr >> 8), // JSR init
+		0x8D, 0x82, 0x41, // STA nsfInitDoneReg
+		0xAD, 0x84, 0x41, // LDA nsfChangeReg
+		0xF0, 0xFB, // BEQ -5
+		0x4C, 0x00, 0x41, // JMP nsfDriverBase
+	}
+	nmi := []byte{
+		0x20, byte(playAddr), byte(playAddr >> 8), // JSR play
+		0x8D, 0x83, 0x41, // STA nsfPlayDoneReg
+		0x40, // RTI
+	}
+
+	m.driver = makeRAM(0x100)
+	for i, b := range driver {
+		*m.driver[i] = b
+	}
+	for i, b := range nmi {
+		*m.driver[nsfDriverNMI-nsfDriverBase+i] = b
+	}
+
+	clock := nsfNTSCClock
+	if r.Timing() == rom.TimingPAL {
+		clock = nsfPALClock
+	}
+	m.period = int(float64(r.PlaySpeed()) * clock)
+
+	return m
+}
+
+// Attach plugs the player in. There's no PPU to wire up.
+func (m *NSF) Attach(n *nes.NES) {
+	m.nes = n
+	n.MapPRG(prgRAMBase, bank(m.prgRAM, prgRAMSize, 0))
+	n.MapPRG(nsfDriverBase, m.driver)
+	m.reset()
+}
+
+func (m *NSF) Tracks() int {
+	return m.nsf.Songs()
+}
+
+func (m *NSF) Track() int {
+	return m.track
+}
+
+// SelectTrack starts track over from the beginning
+func (m *NSF) SelectTrack(track int) {
+	if track < 1 || track > m.nsf.Songs() {
+		return
+	}
+	m.track = track
+	m.changed = true
+}
+
+// reset puts the console in the state the init routine expects: RAM and the
+// sound registers cleared and the starting banks mapped.
+func (m *NSF) reset() {
+	for i := 0; i < 0x0800; i++ {
+		*m.nes.Memory[i] = 0
+	}
+	for _, b := range m.prgRAM {
+		*b = 0
+	}
+	for i := 0x4000; i < 0x4014; i++ {
+		*m.nes.Memory[i] = 0
+	}
+	*m.nes.Memory[0x4015] = 0x0F
+	*m.nes.Memory[0x4017] = 0x40
+
+	m.banks = m.nsf.Banks()
+	m.update()
+
+	m.started = false
+	m.playing = false
+	m.elapsed = 0
+}
+
+func (m *NSF) update() {
+	for i, b := range m.banks {
+		m.mapPRG(0x8000+uint16(i)*0x1000, 0x1000, int(b))
+	}
+}
+
+func (m *NSF) Read(address uint16, debug bool) byte {
+	switch address {
+	case nsfTrackReg:
+		if !debug {
+			m.changed = false
+			m.reset()
+		}
+		return byte(m.track - 1)
+	case nsfRegionReg:
+		if m.nsf.Timing() == rom.TimingPAL {
+			return 1
+		}
+		return 0
+	case nsfChangeReg:
+		if m.changed {
+			return 1
+		}
+		return 0
+	case cpu.VectorNMI:
+		return byte(nsfDriverNMI & 0xFF)
+	case cpu.VectorNMI + 1:
+		return byte(nsfDriverNMI >> 8)
+	case cpu.VectorReset:
+		return byte(nsfDriverBase & 0xFF)
+	case cpu.VectorReset + 1:
+		return byte(nsfDriverBase >> 8)
+	}
+
+	return m.board.Read(address, debug)
+}
+
+func (m *NSF) Write(address uint16, value byte) {
+	switch {
+	case address == nsfInitDoneReg:
+		m.started = true
+	case address == nsfPlayDoneReg:
+		m.playing = false
+	case address >= 0x5FF8 && address < 0x6000:
+		m.banks[address-0x5FF8] = value
+		m.update()
+	default:
+		m.board.Write(address, value)
+	}
+}
+
+// CPUCycles calls the play routine, through NMI, once every play period.
+// A call is skipped if the last one hasn't returned yet.
+func (m *NSF) CPUCycles(cycles int) {
+	if !m.started {
+		return
+	}
+
+	m.elapsed += cycles
+	if m.elapsed < m.period {
+		return
+	}
+	m.elapsed -= m.period
+
+	if m.playing || m.nes.Interrupts == nil {
+		return
+	}
+	m.playing = true
+	m.nes.Interrupts.SetNMI(true)
+	m.nes.Interrupts.SetNMI(false)
+}
@@ -0,0 +1,260 @@
+package mapper
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/evandigby/nesgo/cpu"
+	"github.com/evandigby/nesgo/nes"
+	"github.com/evandigby/nesgo/rom"
+)
+
+// nsfImage is a bankswitched rip of sixteen 4KB banks, each filled with its
+// own number
+func nsfImage() []byte {
+	header := make([]byte, 0x80)
+	copy(header, "NESM\x1A")
+	header[0x05] = 1
+	header[0x06] = 2    // Songs
+	header[0x07] = 1    // Starting song
+	header[0x09] = 0x80 // Load at $8000
+	header[0x0B] = 0x80 // Init at $8000
+	header[0x0C] = 0x03 // Play at $8003
+	header[0x0D] = 0x80
+	for i := 0; i < 8; i++ {
+		header[0x70+i] = byte(i)
+	}
+
+	data := header
+	for i := 0; i < 16; i++ {
+		data = append(data, bytes.Repeat([]byte{byte(i)}, 0x1000)...)
+	}
+	return data
+}
+
+// Starting a track re-banks PRG on a read of $4180, which the CPU has to find
+// out about before it runs code from the old banks.
+func TestNSFTrackResetRemapsPRG(t *testing.T) {
+	r, err := rom.NewNSF(bytes.NewReader(nsfImage()))
+	if err != nil {
+		t.Fatalf("Unable to load test rip: %v", err)
+	}
+	m := NewNSF(r.(*rom.NSF))
+	n, _, _ := insert(m)
+
+	m.Write(0x5FF8, 9)
+	if got := *n.Memory[0x8000]; got != 9 {
+		t.Fatalf("$8000 holds bank %v after switching, want 9", got)
+	}
+	n.Remapped()
+
+	m.Read(nsfTrackReg, true)
+	if _, _, ok := n.Remapped(); ok {
+		t.Errorf("Debug read of $4180 remapped PRG")
+	}
+
+	m.Read(nsfTrackReg, false)
+	if got := *n.Memory[0x8000]; got != 0 {
+		t.Errorf("$8000 holds bank %v after the track reset, want 0", got)
+	}
+	start, end, ok := n.Remapped()
+	if !ok || start > 0x8000 || end <= 0x8000 {
+		t.Errorf("Remapped $%04X-$%04X (%v), want a range covering $8000", start, end, ok)
+	}
+}
+
+// Play period of the test rip, 1000us at the NTSC clock
+const testPlayPeriod = 1789
+
+// nsfRip is an NSF with three songs, starting on the second, whose data loads
+// at $8000. banks are the starting banks, all zero for no bankswitching.
+func nsfRip(t *testing.T, banks [8]byte, data []byte) *rom.NSF {
+	header := make([]byte, 0x80)
+	copy(header, "NESM\x1A")
+	header[0x05] = 1
+	header[0x06] = 3
+	header[0x07] = 2
+	binary.LittleEndian.PutUint16(header[0x08:], 0x8000)
+	binary.LittleEndian.PutUint16(header[0x0A:], 0x8000)
+	binary.LittleEndian.PutUint16(header[0x0C:], 0x8010)
+	binary.LittleEndian.PutUint16(header[0x6E:], 1000)
+	copy(header[0x70:], banks[:])
+
+	r, err := rom.NewNSF(bytes.NewReader(append(header, data...)))
+	if err != nil {
+		t.Fatalf("Unable to load test rip: %v", err)
+	}
+	return r.(*rom.NSF)
+}
+
+// nsfCounters is a rip whose init routine records the track and region it
+// was given in $00 and $01 and counts its calls in $02. The play routine
+// counts its calls in $03.
+func nsfCounters(t *testing.T) *rom.NSF {
+	code := make([]byte, 0x20)
+	copy(code, []byte{
+		0x85, 0x00, // STA $00
+		0x86, 0x01, // STX $01
+		0xE6, 0x02, // INC $02
+		0x60, // RTS
+	})
+	copy(code[0x10:], []byte{
+		0xE6, 0x03, // INC $03
+		0x60, // RTS
+	})
+	return nsfRip(t, [8]byte{}, code)
+}
+
+// nsfConsole runs the player on a real CPU, the way the clock does without a
+// PPU. step runs one instruction and returns its cycles.
+func nsfConsole(m *NSF) (n *nes.NES, step func() int) {
+	n = nes.NewNES()
+	c := cpu.NewCPU(n, nil, nil, nil)
+	n.Insert(m)
+	c.Run()
+
+	return n, func() int {
+		c.Sync <- 0
+		return <-c.Sync
+	}
+}
+
+func TestNSFInitThenPlay(t *testing.T) {
+	m := NewNSF(nsfCounters(t))
+	n, step := nsfConsole(m)
+	ram := func(address int) byte { return *n.Memory[address] }
+
+	// Nothing plays until init has returned
+	cycles := 0
+	for ram(0x02) == 0 {
+		if cycles > 1000 {
+			t.Fatalf("Init wasn't called")
+		}
+		if ram(0x03) != 0 {
+			t.Fatalf("Play called before init")
+		}
+		cycles += step()
+	}
+	if ram(0x00) != 1 || ram(0x01) != 0 {
+		t.Errorf("Init got track %v and region %v, want 1 (the second song) and 0", ram(0x00), ram(0x01))
+	}
+
+	for cycles = 0; cycles < 10*testPlayPeriod+100; {
+		cycles += step()
+	}
+	if ram(0x02) != 1 {
+		t.Errorf("Init called %v times, want once", ram(0x02))
+	}
+	if ram(0x03) != 10 {
+		t.Errorf("Play called %v times in 10 periods, want 10", ram(0x03))
+	}
+
+	// Changing track resets the console and calls init again
+	m.SelectTrack(3)
+	for cycles = 0; ram(0x00) != 2 || ram(0x02) == 0; cycles += step() {
+		if cycles > testPlayPeriod {
+			t.Fatalf("Init wasn't called for the new track")
+		}
+	}
+	if ram(0x02) != 1 || ram(0x03) != 0 {
+		t.Errorf("Init and play counts are %v and %v after the reset, want 1 and 0", ram(0x02), ram(0x03))
+	}
+	if m.Track() != 3 {
+		t.Errorf("Track %v, want 3", m.Track())
+	}
+}
+
+func TestNSFPlayRate(t *testing.T) {
+	m := NewNSF(nsfCounters(t))
+	n, step := nsfConsole(m)
+
+	// The cycle each call to play returned on
+	var calls []int
+	cycles := 0
+	for len(calls) < 5 {
+		plays := *n.Memory[0x03]
+		cycles += step()
+		if *n.Memory[0x03] != plays {
+			calls = append(calls, cycles)
+		}
+		if cycles > 10*testPlayPeriod {
+			t.Fatalf("Play called %v times in 10 periods", len(calls))
+		}
+	}
+
+	// Calls can only start between instructions, so they drift by up to one
+	for i := 1; i < len(calls); i++ {
+		if gap := calls[i] - calls[i-1]; gap < testPlayPeriod-8 || gap > testPlayPeriod+8 {
+			t.Errorf("Play call %v came %v cycles after the last, want about %v", i+1, gap, testPlayPeriod)
+		}
+	}
+}
+
+func TestNSFPlayWaitsForLastCall(t *testing.T) {
+	m := NewNSF(nsfCounters(t))
+	_, _, interrupts := insert(m)
+	nmis := 0
+	m.nes.Interrupts = nmiCounter{&nmis, interrupts}
+
+	m.Write(nsfInitDoneReg, 0)
+	m.CPUCycles(testPlayPeriod)
+	m.CPUCycles(testPlayPeriod)
+	if nmis != 1 {
+		t.Errorf("%v NMIs while play was still running, want 1", nmis)
+	}
+
+	m.Write(nsfPlayDoneReg, 0)
+	m.CPUCycles(testPlayPeriod)
+	if nmis != 2 {
+		t.Errorf("%v NMIs after play returned, want 2", nmis)
+	}
+}
+
+// nmiCounter counts NMI edges
+type nmiCounter struct {
+	count *int
+	*testInterrupts
+}
+
+func (c nmiCounter) SetNMI(active bool) {
+	if active {
+		*c.count++
+	}
+}
+
+func TestNSFBanks(t *testing.T) {
+	// Every byte of a bank holds its number
+	data := make([]byte, 8*0x1000)
+	for i := range data {
+		data[i] = byte(i / 0x1000)
+	}
+	m := NewNSF(nsfRip(t, [8]byte{7, 6, 5, 4, 3, 2, 1, 0}, data))
+	n, _, _ := insert(m)
+
+	banks := func() [8]byte {
+		var b [8]byte
+		for i := range b {
+			b[i] = *n.Memory[0x8000+i*0x1000]
+		}
+		return b
+	}
+
+	if got := banks(); got != [8]byte{7, 6, 5, 4, 3, 2, 1, 0} {
+		t.Errorf("Starting banks %v, want the header's", got)
+	}
+
+	for i := 0; i < 8; i++ {
+		m.Write(0x5FF8+uint16(i), byte(i))
+	}
+	if got := banks(); got != [8]byte{0, 1, 2, 3, 4, 5, 6, 7} {
+		t.Errorf("Banks %v after writing $5FF8-$5FFF", got)
+	}
+
+	// A new track starts from the header's banks again
+	m.SelectTrack(1)
+	m.Read(nsfTrackReg, false)
+	if got := banks(); got != [8]byte{7, 6, 5, 4, 3, 2, 1, 0} {
+		t.Errorf("Banks %v after a track change, want the header's", got)
+	}
+}
@@ -0,0 +1,162 @@
+package mapper
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/evandigby/nesgo/nes"
+)
+
+// SaveFile keeps a cartridge's battery backed RAM in a .sav file next to the
+// ROM. The file is replaced atomically so a crash mid-write can't corrupt the
+// last good save.
+//
+// RAM belongs to the emulation goroutine, so it's only read by Capture, which
+// runs there. Flush writes the last capture and can run anywhere.
+type SaveFile struct {
+	path string
+	ram  []*byte
+
+	mu       sync.Mutex
+	saved    []byte
+	captured []byte
+}
+
+// SavePath returns the .sav file that goes with a ROM
+func SavePath(romPath string) string {
+	return strings.TrimSuffix(romPath, filepath.Ext(romPath)) + ".sav"
+}
+
+// NewSaveFile returns the save file for a cartridge, or nil if the cartridge
+// has no battery.
+func NewSaveFile(romPath string, m nes.Mapper) *SaveFile {
+	b, ok := m.(nes.Battery)
+	if !ok || b.BatteryRAM() == nil {
+		return nil
+	}
+
+	return &SaveFile{path: SavePath(romPath), ram: b.BatteryRAM()}
+}
+
+func (s *SaveFile) Path() string {
+	return s.path
+}
+
+// Load copies the save file into RAM. A missing file isn't an error, the
+// game just hasn't been saved yet. Load before the cartridge is inserted, so
+// the emulation isn't running yet and a trainer copied in by Attach isn't
+// overwritten.
+func (s *SaveFile) Load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		s.saved = s.snapshot()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < len(data) && i < len(s.ram); i++ {
+		*s.ram[i] = data[i]
+	}
+	s.saved = s.snapshot()
+
+	return nil
+}
+
+// Bytes returns a copy of the battery backed RAM as it is now. Like Capture,
+// it has to run on the emulation goroutine.
+func (s *SaveFile) Bytes() []byte {
+	return s.snapshot()
+}
+
+// Capture copies RAM for the next Flush. It has to run on the emulation
+// goroutine, between instructions, so the copy isn't torn by a write.
+func (s *SaveFile) Capture() {
+	data := s.snapshot()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.captured = data
+}
+
+func (s *SaveFile) snapshot() []byte {
+	data := make([]byte, len(s.ram))
+	for i, b := range s.ram {
+		data[i] = *b
+	}
+	return data
+}
+
+// Flush writes the last capture to the save file if it changed since the last
+// flush
+func (s *SaveFile) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data := s.captured
+	if data == nil || bytes.Equal(data, s.saved) {
+		return nil
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	s.saved = data
+	return nil
+}
+
+// Autosave captures and flushes every interval until stop is closed. call runs
+// Capture on the emulation goroutine, the way Clock.Call does. Errors are
+// passed to onError so the caller can decide how loud to be about them. The
+// returned channel is closed once autosaving has stopped, so a final Flush
+// can't race it.
+func (s *SaveFile) Autosave(interval time.Duration, call func(func()), stop <-chan bool, onError func(error)) <-chan bool {
+	stopped := make(chan bool)
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer close(stopped)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				call(s.Capture)
+				if err := s.Flush(); err != nil && onError != nil {
+					onError(err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return stopped
+}
@@ -0,0 +1,113 @@
+package mapper
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// direct stands in for Clock.Call when there's no clock running
+func direct(f func()) { f() }
+
+func TestSaveFileRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nesgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	romPath := filepath.Join(dir, "game.nes")
+	cart := testCart{mapper: 0, prg: 2, chr: 1, flags6: 0x02}
+
+	m := NewNROM(cart.rom(t))
+	save := NewSaveFile(romPath, m)
+	if save == nil {
+		t.Fatalf("No save file for a cartridge with a battery")
+	}
+	if err := save.Load(); err != nil {
+		t.Fatalf("Loading a missing save: %v", err)
+	}
+	insert(m)
+
+	m.Write(0x6000, 0x12)
+	m.Write(0x7FFF, 0x34)
+
+	// Nothing is written until RAM is captured
+	if err := save.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(save.Path()); !os.IsNotExist(err) {
+		t.Fatalf("Flush wrote RAM it never captured")
+	}
+
+	direct(save.Capture)
+	m.Write(0x6000, 0x56) // After the capture, so not saved
+	if err := save.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "game.sav"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != prgRAMSize || data[0] != 0x12 || data[len(data)-1] != 0x34 {
+		t.Errorf("Save file holds the wrong RAM")
+	}
+
+	m = NewNROM(cart.rom(t))
+	save = NewSaveFile(romPath, m)
+	if err := save.Load(); err != nil {
+		t.Fatal(err)
+	}
+	insert(m)
+	if got := m.Read(0x7FFF, false); got != 0x34 {
+		t.Errorf("$7FFF is $%02X after loading, want $34", got)
+	}
+	if !bytes.Equal(save.Bytes(), data) {
+		t.Errorf("Loaded RAM doesn't match the save file")
+	}
+}
+
+func TestNoSaveFileWithoutBattery(t *testing.T) {
+	m := NewNROM(testCart{mapper: 0, prg: 2, chr: 1}.rom(t))
+	if save := NewSaveFile("game.nes", m); save != nil {
+		t.Errorf("Save file for a cartridge without a battery")
+	}
+}
+
+func TestTrainerSurvivesSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nesgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	romPath := filepath.Join(dir, "game.nes")
+
+	trainer := make([]byte, 512)
+	for i := range trainer {
+		trainer[i] = byte(i)
+	}
+	if err := ioutil.WriteFile(SavePath(romPath), bytes.Repeat([]byte{0xFF}, prgRAMSize), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewNROM(testCart{mapper: 0, prg: 2, chr: 1, flags6: 0x06, trainer: trainer}.rom(t))
+	save := NewSaveFile(romPath, m)
+	if err := save.Load(); err != nil {
+		t.Fatal(err)
+	}
+	insert(m)
+
+	for i, want := range trainer {
+		if got := m.Read(trainerBase+uint16(i), false); got != want {
+			t.Fatalf("$%04X is $%02X, want trainer byte $%02X", trainerBase+i, got, want)
+		}
+	}
+	if got := m.Read(0x6000, false); got != 0xFF {
+		t.Errorf("$6000 is $%02X, want $FF from the save", got)
+	}
+	if got := m.Read(0x7200, false); got != 0xFF {
+		t.Errorf("$7200 is $%02X, want $FF from the save", got)
+	}
+}
@@ -0,0 +1,407 @@
+package mapper
+
+import (
+	"github.com/evandigby/nesgo/nes"
+	"github.com/evandigby/nesgo/rom"
+)
+
+// ExpansionAudio receives writes to a cartridge's sound registers. There is
+// no APU to mix it into yet, so writes are dropped unless one is set.
+type ExpansionAudio interface {
+	WriteAudio(address uint16, value byte)
+}
+
+// Konami wired the register select pins of the VRC chips to different CPU
+// address lines on different boards. vrcLines holds the address bits that
+// drive register select bits 0 and 1. Without a submapper we can't tell the
+// boards apart, so both candidate lines are used.
+type vrcLines struct {
+	a0, a1 uint16
+}
+
+func (l vrcLines) register(address uint16) uint16 {
+	r := address & 0xF000
+	if address&l.a0 != 0 {
+		r |= 1
+	}
+	if address&l.a1 != 0 {
+		r |= 2
+	}
+	return r
+}
+
+// vrcIRQ is the IRQ counter shared by the VRC4, VRC6 and VRC7. In scanline
+// mode a prescaler divides CPU cycles by 113 2/3 to approximate scanlines;
+// in cycle mode the counter is clocked every CPU cycle. Either way the IRQ
+// fires when the 8 bit counter overflows, and it's reloaded from the latch.
+type vrcIRQ struct {
+	board     *board
+	latch     byte
+	counter   byte
+	prescaler int
+	enabled   bool
+	enableAck bool
+	cycleMode bool
+}
+
+func (v *vrcIRQ) writeLatchLow(value byte)  { v.latch = (v.latch & 0xF0) | (value & 0x0F) }
+func (v *vrcIRQ) writeLatchHigh(value byte) { v.latch = (v.latch & 0x0F) | (value << 4) }
+
+func (v *vrcIRQ) writeControl(value byte) {
+	v.enableAck = value&1 != 0
+	v.enabled = value&2 != 0
+	v.cycleMode = value&4 != 0
+	if v.enabled {
+		v.counter = v.latch
+		v.prescaler = 341
+	}
+	v.board.setIRQ(false)
+}
+
+func (v *vrcIRQ) acknowledge() {
+	v.enabled = v.enableAck
+	v.board.setIRQ(false)
+}
+
+func (v *vrcIRQ) CPUCycles(cycles int) {
+	if !v.enabled {
+		return
+	}
+
+	for i := 0; i < cycles; i++ {
+		if !v.cycleMode {
+			v.prescaler -= 3
+			if v.prescaler > 0 {
+				continue
+			}
+			v.prescaler += 341
+		}
+
+		if v.counter == 0xFF {
+			v.counter = v.latch
+			v.board.setIRQ(true)
+		} else {
+			v.counter++
+		}
+	}
+}
+
+func vrcMirroring(value byte) rom.Mirroring {
+	switch value & 3 {
+	case 0:
+		return rom.MirrorVertical
+	case 1:
+		return rom.MirrorHorizontal
+	case 2:
+		return rom.MirrorSingleA
+	default:
+		return rom.MirrorSingleB
+	}
+}
+
+// VRC4 covers the VRC2 and VRC4 boards (mappers 21, 22, 23 and 25). The VRC2
+// is a subset of the VRC4 without the IRQ counter or PRG swap mode.
+type VRC4 struct {
+	*board
+	irq *vrcIRQ
+
+	lines    vrcLines
+	vrc2     bool
+	chrShift uint
+
+	prg     [2]byte
+	prgSwap bool
+	chr     [8]uint16
+}
+
+func NewVRC4(r rom.ROM) *VRC4 {
+	m := &VRC4{board: newBoard(r)}
+	m.irq = &vrcIRQ{board: m.board}
+
+	switch r.Mapper() {
+	case 21:
+		switch r.Submapper() {
+		case 1: // VRC4a
+			m.lines = vrcLines{0x02, 0x04}
+		case 2: // VRC4c
+			m.lines = vrcLines{0x40, 0x80}
+		default:
+			m.lines = vrcLines{0x42, 0x84}
+		}
+	case 22: // VRC2a
+		m.lines = vrcLines{0x02, 0x01}
+		m.vrc2 = true
+		m.chrShift = 1
+	case 23:
+		switch r.Submapper() {
+		case 1: // VRC4f
+			m.lines = vrcLines{0x01, 0x02}
+		case 2: // VRC4e
+			m.lines = vrcLines{0x04, 0x08}
+		case 3: // VRC2b
+			m.lines = vrcLines{0x01, 0x02}
+			m.vrc2 = true
+		default:
+			m.lines = vrcLines{0x05, 0x0A}
+		}
+	case 25:
+		switch r.Submapper() {
+		case 1: // VRC4b
+			m.lines = vrcLines{0x02, 0x01}
+		case 2: // VRC4d
+			m.lines = vrcLines{0x08, 0x04}
+		case 3: // VRC2c
+			m.lines = vrcLines{0x02, 0x01}
+			m.vrc2 = true
+		default:
+			m.lines = vrcLines{0x0A, 0x05}
+		}
+	}
+
+	return m
+}
+
+func (m *VRC4) Attach(n *nes.NES) {
+	m.board.Attach(n)
+	m.update()
+}
+
+func (m *VRC4) CPUCycles(cycles int) {
+	if !m.vrc2 {
+		m.irq.CPUCycles(cycles)
+	}
+}
+
+func (m *VRC4) Write(address uint16, value byte) {
+	if address < 0x8000 {
+		m.board.Write(address, value)
+		return
+	}
+
+	reg := m.lines.register(address)
+	switch {
+	case reg <= 0x8003:
+		m.prg[0] = value & 0x1F
+	case reg <= 0x9003:
+		switch {
+		case m.vrc2:
+			m.setMirroring(vrcMirroring(value & 1))
+		case reg == 0x9000:
+			m.setMirroring(vrcMirroring(value))
+		case reg&2 != 0:
+			m.prgSwap = value&0x02 != 0
+		}
+	case reg <= 0xA003:
+		m.prg[1] = value & 0x1F
+	case reg <= 0xE003:
+		// Each 1KB bank is written a nibble at a time, low then high
+		bank := ((reg>>12)-0xB)*2 + (reg&2)>>1
+		if reg&1 == 0 {
+			m.chr[bank] = (m.chr[bank] & 0x1F0) | uint16(value&0x0F)
+		} else {
+			m.chr[bank] = (m.chr[bank] & 0x00F) | uint16(value&0x1F)<<4
+		}
+	// The rest don't touch the banks, and IRQ registers are written too
+	// often to remap PRG every time
+	case m.vrc2:
+		return
+	case reg == 0xF000:
+		m.irq.writeLatchLow(value)
+		return
+	case reg == 0xF001:
+		m.irq.writeLatchHigh(value)
+		return
+	case reg == 0xF002:
+		m.irq.writeControl(value)
+		return
+	case reg == 0xF003:
+		m.irq.acknowledge()
+		return
+	}
+
+	m.update()
+}
+
+func (m *VRC4) update() {
+	if m.prgSwap {
+		m.mapPRG(0x8000, 0x2000, -2)
+		m.mapPRG(0xC000, 0x2000, int(m.prg[0]))
+	} else {
+		m.mapPRG(0x8000, 0x2000, int(m.prg[0]))
+		m.mapPRG(0xC000, 0x2000, -2)
+	}
+	m.mapPRG(0xA000, 0x2000, int(m.prg[1]))
+	m.mapPRG(0xE000, 0x2000, -1)
+
+	for i, b := range m.chr {
+		m.mapCHR(uint16(i)*0x400, 0x400, int(b>>m.chrShift))
+	}
+}
+
+// VRC6 (mappers 24 and 26) has 16KB + 8KB PRG banking, 1KB CHR banks and
+// three extra sound channels.
+type VRC6 struct {
+	*board
+	irq *vrcIRQ
+
+	Audio ExpansionAudio
+
+	lines vrcLines
+	prg   [2]byte
+	chr   [8]byte
+}
+
+func NewVRC6(r rom.ROM) *VRC6 {
+	m := &VRC6{board: newBoard(r), lines: vrcLines{0x01, 0x02}}
+	m.irq = &vrcIRQ{board: m.board}
+	if r.Mapper() == 26 {
+		m.lines = vrcLines{0x02, 0x01}
+	}
+	return m
+}
+
+func (m *VRC6) Attach(n *nes.NES) {
+	m.board.Attach(n)
+	m.update()
+}
+
+func (m *VRC6) CPUCycles(cycles int) {
+	m.irq.CPUCycles(cycles)
+}
+
+func (m *VRC6) Write(address uint16, value byte) {
+	if address < 0x8000 {
+		m.board.Write(address, value)
+		return
+	}
+
+	reg := m.lines.register(address)
+	switch {
+	case reg <= 0x8003:
+		m.prg[0] = value & 0x0F
+	case reg == 0xB003:
+		m.setMirroring(vrcMirroring(value >> 2))
+		m.prgRAMDisabled = value&0x80 == 0
+	case reg <= 0xB002:
+		if m.Audio != nil {
+			m.Audio.WriteAudio(reg, value)
+		}
+		return
+	case reg <= 0xC003:
+		m.prg[1] = value & 0x1F
+	case reg <= 0xE003:
+		m.chr[((reg>>12)-0xD)*4+reg&3] = value
+	case reg == 0xF000:
+		m.irq.latch = value
+		return
+	case reg == 0xF001:
+		m.irq.writeControl(value)
+		return
+	case reg == 0xF002:
+		m.irq.acknowledge()
+		return
+	}
+
+	m.update()
+}
+
+func (m *VRC6) update() {
+	m.mapPRG(0x8000, 0x4000, int(m.prg[0]))
+	m.mapPRG(0xC000, 0x2000, int(m.prg[1]))
+	m.mapPRG(0xE000, 0x2000, -1)
+
+	for i, b := range m.chr {
+		m.mapCHR(uint16(i)*0x400, 0x400, int(b))
+	}
+}
+
+// VRC7 (mapper 85) has three 8KB PRG banks, 1KB CHR banks and an FM
+// synthesizer.
+type VRC7 struct {
+	*board
+	irq *vrcIRQ
+
+	Audio ExpansionAudio
+
+	line uint16
+	prg  [3]byte
+	chr  [8]byte
+}
+
+func NewVRC7(r rom.ROM) *VRC7 {
+	m := &VRC7{board: newBoard(r)}
+	m.irq = &vrcIRQ{board: m.board}
+
+	switch r.Submapper() {
+	case 1: // VRC7b
+		m.line = 0x08
+	case 2: // VRC7a
+		m.line = 0x10
+	default:
+		m.line = 0x18
+	}
+
+	return m
+}
+
+func (m *VRC7) Attach(n *nes.NES) {
+	m.board.Attach(n)
+	m.update()
+}
+
+func (m *VRC7) CPUCycles(cycles int) {
+	m.irq.CPUCycles(cycles)
+}
+
+func (m *VRC7) Write(address uint16, value byte) {
+	if address < 0x8000 {
+		m.board.Write(address, value)
+		return
+	}
+
+	reg := address & 0xF000
+	if address&m.line != 0 {
+		reg |= 0x10
+	}
+
+	switch reg {
+	case 0x8000:
+		m.prg[0] = value & 0x3F
+	case 0x8010:
+		m.prg[1] = value & 0x3F
+	case 0x9000:
+		m.prg[2] = value & 0x3F
+	case 0x9010:
+		if m.Audio != nil {
+			m.Audio.WriteAudio(address, value)
+		}
+		return
+	case 0xA000, 0xA010, 0xB000, 0xB010, 0xC000, 0xC010, 0xD000, 0xD010:
+		m.chr[((reg>>12)-0xA)*2+(reg>>4)&1] = value
+	case 0xE000:
+		m.setMirroring(vrcMirroring(value))
+		m.prgRAMDisabled = value&0x80 == 0
+	case 0xE010:
+		m.irq.latch = value
+		return
+	case 0xF000:
+		m.irq.writeControl(value)
+		return
+	case 0xF010:
+		m.irq.acknowledge()
+		return
+	}
+
+	m.update()
+}
+
+func (m *VRC7) update() {
+	m.mapPRG(0x8000, 0x2000, int(m.prg[0]))
+	m.mapPRG(0xA000, 0x2000, int(m.prg[1]))
+	m.mapPRG(0xC000, 0x2000, int(m.prg[2]))
+	m.mapPRG(0xE000, 0x2000, -1)
+
+	for i, b := range m.chr {
+		m.mapCHR(uint16(i)*0x400, 0x400, int(b))
+	}
+}
@@ -0,0 +1,198 @@
+package mapper
+
+import (
+	"testing"
+
+	"github.com/evandigby/nesgo/nes"
+)
+
+// The VRC4a (mapper 21, submapper 1) puts register select on A1 and A2, so
+// register $x001 is at $x002, $x002 at $x004 and $x003 at $x006.
+func newVRC4a(t *testing.T) *VRC4 {
+	return NewVRC4(testCart{mapper: 21, submapper: 1, prg: 8, chr: 8}.rom(t))
+}
+
+func TestVRC4Banks(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []write
+		prg    [4]int
+		chr    [8]int
+	}{
+		{
+			name:   "PRG",
+			writes: []write{{0x8000, 3}, {0xA000, 5}},
+			prg:    [4]int{3, 5, 14, 15},
+		},
+		{
+			name:   "PRG swapped",
+			writes: []write{{0x8000, 3}, {0xA000, 5}, {0x9004, 0x02}},
+			prg:    [4]int{14, 5, 3, 15},
+		},
+		{
+			name:   "CHR nibbles",
+			writes: []write{{0xB000, 0x02}, {0xB002, 0x01}, {0xB004, 0x07}, {0xE006, 0x03}},
+			prg:    [4]int{0, 0, 14, 15},
+			chr:    [8]int{0x12, 0x07, 0, 0, 0, 0, 0, 0x30},
+		},
+	}
+
+	for _, test := range tests {
+		m := newVRC4a(t)
+		n, p, _ := insert(m)
+		for _, w := range test.writes {
+			m.Write(w.address, w.value)
+		}
+
+		if got := prgBanks(n); got != test.prg {
+			t.Errorf("%v: PRG banks %v, want %v", test.name, got, test.prg)
+		}
+		if got := chrBanks(p); got != test.chr {
+			t.Errorf("%v: CHR banks %v, want %v", test.name, got, test.chr)
+		}
+	}
+}
+
+// irqCycle runs the CPU one cycle at a time and returns the cycle the IRQ
+// was asserted on, or 0 if it wasn't within limit cycles.
+func irqCycle(c interface{ CPUCycles(int) }, irq *testInterrupts, limit int) int {
+	for i := 1; i <= limit; i++ {
+		c.CPUCycles(1)
+		if irq.irq {
+			return i
+		}
+	}
+	return 0
+}
+
+func TestVRCIRQCycleMode(t *testing.T) {
+	m := newVRC4a(t)
+	_, _, irq := insert(m)
+
+	m.Write(0xF000, 0x0D) // Latch low
+	m.Write(0xF002, 0x0F) // Latch high, $FD
+	m.Write(0xF004, 0x06) // Enable in cycle mode
+
+	if got := irqCycle(m, irq, 10); got != 3 {
+		t.Errorf("IRQ on cycle %v, want 3", got)
+	}
+
+	// Acknowledging without enable-after-ack set stops the counter
+	m.Write(0xF006, 0)
+	if irq.irq {
+		t.Errorf("IRQ still asserted after acknowledge")
+	}
+	if got := irqCycle(m, irq, 1000); got != 0 {
+		t.Errorf("IRQ on cycle %v after acknowledge, want none", got)
+	}
+}
+
+// In scanline mode the prescaler clocks the counter every 113 2/3 CPU cycles,
+// so three scanlines are exactly 341 cycles.
+func TestVRCIRQScanlineMode(t *testing.T) {
+	m := newVRC4a(t)
+	_, _, irq := insert(m)
+
+	m.Write(0xF000, 0x0D)
+	m.Write(0xF002, 0x0F)
+	m.Write(0xF004, 0x03) // Enable in scanline mode, re-enable after ack
+
+	if got := irqCycle(m, irq, 1000); got != 341 {
+		t.Errorf("IRQ on cycle %v, want 341", got)
+	}
+
+	// The counter reloaded and keeps running after an acknowledge
+	m.Write(0xF006, 0)
+	if got := irqCycle(m, irq, 1000); got != 341 {
+		t.Errorf("Second IRQ after %v cycles, want 341", got)
+	}
+}
+
+func TestVRC2HasNoIRQ(t *testing.T) {
+	m := NewVRC4(testCart{mapper: 22, prg: 8, chr: 8}.rom(t))
+	_, _, irq := insert(m)
+
+	m.Write(0xF000, 0x0F)
+	m.Write(0xF002, 0x0F)
+	m.Write(0xF001, 0x06)
+	m.Write(0xF003, 0x06)
+	if got := irqCycle(m, irq, 1000); got != 0 {
+		t.Errorf("VRC2 asserted an IRQ on cycle %v", got)
+	}
+}
+
+func TestVRC6Banks(t *testing.T) {
+	writes := []write{{0x8000, 2}, {0xC000, 7}, {0xD001, 9}}
+
+	tests := []struct {
+		mapper int
+		prg    [4]int
+		chr    [8]int
+	}{
+		{24, [4]int{4, 5, 7, 15}, [8]int{0, 9, 0, 0, 0, 0, 0, 0}},
+		// Mapper 26 swaps A0 and A1, so $D001 is register $D002
+		{26, [4]int{4, 5, 7, 15}, [8]int{0, 0, 9, 0, 0, 0, 0, 0}},
+	}
+
+	for _, test := range tests {
+		m := NewVRC6(testCart{mapper: test.mapper, prg: 8, chr: 8}.rom(t))
+		n, p, _ := insert(m)
+		for _, w := range writes {
+			m.Write(w.address, w.value)
+		}
+
+		if got := prgBanks(n); got != test.prg {
+			t.Errorf("Mapper %v: PRG banks %v, want %v", test.mapper, got, test.prg)
+		}
+		if got := chrBanks(p); got != test.chr {
+			t.Errorf("Mapper %v: CHR banks %v, want %v", test.mapper, got, test.chr)
+		}
+	}
+}
+
+func TestVRC6IRQ(t *testing.T) {
+	m := NewVRC6(testCart{mapper: 24, prg: 8, chr: 8}.rom(t))
+	_, _, irq := insert(m)
+
+	m.Write(0xF000, 0xFE) // Latch
+	m.Write(0xF001, 0x06) // Enable in cycle mode
+
+	if got := irqCycle(m, irq, 10); got != 2 {
+		t.Errorf("IRQ on cycle %v, want 2", got)
+	}
+	m.Write(0xF002, 0)
+	if irq.irq {
+		t.Errorf("IRQ still asserted after acknowledge")
+	}
+}
+
+// IRQ writes happen every scanline in some games, and mustn't throw away the
+// CPU's decoded PRG each time
+func TestVRCIRQWritesDontRemap(t *testing.T) {
+	tests := []struct {
+		name   string
+		mapper nes.Mapper
+		writes []write
+	}{
+		{"VRC4", newVRC4a(t), []write{{0xF000, 0x0D}, {0xF002, 0x0F}, {0xF004, 0x02}, {0xF006, 0}}},
+		{"VRC6", NewVRC6(testCart{mapper: 24, prg: 8, chr: 8}.rom(t)), []write{{0xF000, 0xFD}, {0xF001, 0x02}, {0xF002, 0}, {0x9000, 0x8F}}},
+		{"VRC7", NewVRC7(testCart{mapper: 85, prg: 8, chr: 8}.rom(t)), []write{{0xE008, 0xFD}, {0xF000, 0x02}, {0xF008, 0}, {0x9010, 0x01}}},
+	}
+
+	for _, test := range tests {
+		n, _, _ := insert(test.mapper)
+		n.Remapped()
+
+		for _, w := range test.writes {
+			test.mapper.Write(w.address, w.value)
+		}
+		if start, end, ok := n.Remapped(); ok {
+			t.Errorf("%v: IRQ and sound writes remapped $%04X-$%04X", test.name, start, end)
+		}
+
+		test.mapper.Write(0x8000, 1)
+		if _, _, ok := n.Remapped(); !ok {
+			t.Errorf("%v: PRG bank write didn't remap", test.name)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+package nes
+
+// IRQSource identifies a device driving the shared /IRQ line. The line is
+// wired-OR, so it stays asserted until every source has released it.
+type IRQSource uint8
+
+const (
+	IRQMapper IRQSource = 1 << iota
+)
+
+type Interrupts interface {
+	SetNMI(active bool)
+	SetIRQ(source IRQSource, active bool)
+}
@@ -0,0 +1,87 @@
+package nes
+
+import "github.com/evandigby/nesgo/rom"
+
+// CartridgeStart is the first CPU address owned by the cartridge
+const CartridgeStart = 0x4020
+
+// Mapper is a cartridge board. It owns the CPU $4020-$FFFF and PPU
+// $0000-$1FFF address spaces, reacts to writes into them, and swaps PRG and
+// CHR banks in and out of them.
+type Mapper interface {
+	Attach(n *NES)
+	Read(address uint16, debug bool) byte
+	Write(address uint16, value byte)
+	WriteCHR(address uint16, value byte)
+}
+
+// PPUBus is the side of the PPU a cartridge is wired to
+type PPUBus interface {
+	PatternTables() []*byte
+	SetMirroring(mode rom.Mirroring)
+	Nametable(page int) []*byte
+	MapNametable(table int, page []*byte)
+}
+
+// PPUWatcher is implemented by mappers that snoop the PPU address bus, such
+// as the MMC3 scanline counter which is clocked by A12.
+type PPUWatcher interface {
+	PPUAddress(address uint16)
+}
+
+// PPUFetch is the kind of rendering fetch the PPU is making
+type PPUFetch int
+
+const (
+	FetchNametable PPUFetch = iota
+	FetchAttribute
+	FetchBackground
+	FetchSprite
+)
+
+// PPUFetcher is implemented by mappers that take part in rendering, like the
+// MMC5. Every rendering fetch is passed through Fetch, and the PPU uses the
+// returned byte in place of value.
+type PPUFetcher interface {
+	Fetch(kind PPUFetch, address uint16, value byte) byte
+}
+
+// NametableROM is implemented by mappers that can point nametables at
+// CHR-ROM, like the Namco 163. The PPU drops writes to a nametable that
+// NametableIsROM reports as ROM.
+type NametableROM interface {
+	NametableIsROM(table int) bool
+}
+
+// CPUWatcher is implemented by mappers that snoop CPU writes outside the
+// cartridge address space, like the MMC5 watching PPUCTRL and PPUMASK.
+type CPUWatcher interface {
+	CPUWrite(address uint16, value byte)
+}
+
+// CPUCycleCounter is implemented by mappers with counters clocked by the CPU,
+// like the VRC IRQ.
+type CPUCycleCounter interface {
+	CPUCycles(cycles int)
+}
+
+// Battery is implemented by cartridges whose RAM is kept powered by a
+// battery. BatteryRAM returns nil when the board has no battery.
+type Battery interface {
+	BatteryRAM() []*byte
+}
+
+// DiskDrive is implemented by the Famicom Disk System. Sides are numbered
+// from 0, and inserting a disk ejects the current one first.
+type DiskDrive interface {
+	Sides() int
+	InsertDisk(side int)
+	EjectDisk()
+}
+
+// Player is implemented by the NSF player. Tracks are numbered from 1.
+type Player interface {
+	Tracks() int
+	Track() int
+	SelectTrack(track int)
+}
@@ -1,7 +1,5 @@
 package nes
 
-import "github.com/evandigby/nesgo/rom"
-
 type ByteReadWriter interface {
 	Read(debug bool) byte
 	Write(val byte)
@@ -16,6 +14,13 @@ type NES struct {
 
 	MemoryMap map[uint16]ByteReadWriter
 
+	Interrupts Interrupts `json:"-"`
+	Mapper     Mapper     `json:"-"`
+	PPU        PPUBus     `json:"-"`
+
+	remapStart int
+	remapEnd   int
+
 	Debug bool
 }
 
@@ -48,16 +53,39 @@ func NewNES() *NES {
 	}
 }
 
-func (n *NES) LoadRom(r rom.ROM) {
-	mirror := r.Pages() == 1
-	for i, v := range r.ProgramRom() {
-		*n.Cartridge[i] = *v
-		if mirror {
-			*n.Cartridge[i+0x4000] = *v
-		}
+func (n *NES) Insert(m Mapper) {
+	n.Mapper = m
+	m.Attach(n)
+}
+
+// MapPRG points the CPU address space starting at address at bank. Any
+// instructions decoded from the range are stale until the CPU picks up the
+// change through Remapped.
+func (n *NES) MapPRG(address uint16, bank []*byte) {
+	start := int(address)
+	end := start + copy(n.Memory[start:], bank)
+
+	if n.remapEnd == 0 || start < n.remapStart {
+		n.remapStart = start
+	}
+	if end > n.remapEnd {
+		n.remapEnd = end
 	}
 }
 
+// Remapped returns, and clears, the range of CPU addresses remapped since the
+// last call.
+func (n *NES) Remapped() (start, end int, ok bool) {
+	if n.remapEnd == 0 {
+		return 0, 0, false
+	}
+
+	start, end = n.remapStart, n.remapEnd
+	n.remapStart, n.remapEnd = 0, 0
+
+	return start, end, true
+}
+
 func (n *NES) PowerUp() {
 	/*
 		for i := 0; i < 0x0800; i++ {
@@ -84,6 +112,10 @@ func (n *NES) Get(address uint16) byte {
 		return m.Read(n.Debug)
 	}
 
+	if address >= CartridgeStart && n.Mapper != nil {
+		return n.Mapper.Read(address, n.Debug)
+	}
+
 	return *n.Memory[address]
 }
 
@@ -96,5 +128,14 @@ func (n *NES) Set(address uint16, value byte) {
 		m.Write(value)
 	}
 
+	if w, ok := n.Mapper.(CPUWatcher); ok && address < CartridgeStart {
+		w.CPUWrite(address, value)
+	}
+
+	if address >= CartridgeStart && n.Mapper != nil {
+		n.Mapper.Write(address, value)
+		return
+	}
+
 	*n.Memory[address] = value
 }
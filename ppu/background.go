@@ -0,0 +1,159 @@
+package ppu
+
+import "github.com/evandigby/nesgo/nes"
+
+// Background tiles are fetched two tiles ahead of the beam. Each tile takes
+// eight dots: nametable byte, attribute byte, then the low and high pattern
+// planes. The fetched tile is loaded into the low byte of the shift registers
+// while the high byte holds the tile currently being drawn.
+
+func (p *PPU) renderingEnabled() bool {
+	return p.PPUMASK&0x18 != 0
+}
+
+// incrementX moves v to the next tile column, wrapping into the horizontally
+// adjacent nametable.
+func (p *PPU) incrementX() {
+	if p.vramAddr&0x001F == 31 {
+		p.vramAddr &^= 0x001F
+		p.vramAddr ^= 0x0400
+	} else {
+		p.vramAddr++
+	}
+}
+
+// incrementY moves v to the next pixel row, wrapping fine Y into coarse Y and
+// coarse Y into the vertically adjacent nametable after row 29.
+func (p *PPU) incrementY() {
+	if p.vramAddr&0x7000 != 0x7000 {
+		p.vramAddr += 0x1000
+		return
+	}
+
+	p.vramAddr &^= 0x7000
+	y := (p.vramAddr & 0x03E0) >> 5
+	switch y {
+	case 29:
+		y = 0
+		p.vramAddr ^= 0x0800
+	case 31:
+		y = 0
+	default:
+		y++
+	}
+	p.vramAddr = (p.vramAddr &^ 0x03E0) | (y << 5)
+}
+
+func (p *PPU) copyX() {
+	p.vramAddr = (p.vramAddr &^ 0x041F) | (p.tvramAddr & 0x041F)
+}
+
+func (p *PPU) copyY() {
+	p.vramAddr = (p.vramAddr &^ 0x7BE0) | (p.tvramAddr & 0x7BE0)
+}
+
+func (p *PPU) fetchNametable() {
+	p.ntByte = p.fetch(nes.FetchNametable, 0x2000|(p.vramAddr&0x0FFF))
+}
+
+func (p *PPU) fetchAttribute() {
+	v := p.vramAddr
+	at := p.fetch(nes.FetchAttribute, 0x23C0|(v&0x0C00)|((v>>4)&0x38)|((v>>2)&0x07))
+
+	shift := uint(((v >> 4) & 4) | (v & 2))
+	p.atByte = (at >> shift) & 3
+}
+
+func (p *PPU) patternAddress() uint16 {
+	base := uint16(p.PPUCTRL&0x10) << 8
+
+	return base + uint16(p.ntByte)*16 + (p.vramAddr>>12)&7
+}
+
+func (p *PPU) fetchPatternLow() {
+	p.bgLow = p.fetch(nes.FetchBackground, p.patternAddress())
+}
+
+func (p *PPU) fetchPatternHigh() {
+	p.bgHigh = p.fetch(nes.FetchBackground, p.patternAddress()+8)
+}
+
+func (p *PPU) shiftBackground() {
+	p.bgShiftLow <<= 1
+	p.bgShiftHigh <<= 1
+	p.atShiftLow <<= 1
+	p.atShiftHigh <<= 1
+}
+
+func (p *PPU) reloadBackground() {
+	p.bgShiftLow = (p.bgShiftLow & 0xFF00) | uint16(p.bgLow)
+	p.bgShiftHigh = (p.bgShiftHigh & 0xFF00) | uint16(p.bgHigh)
+
+	p.atShiftLow &= 0xFF00
+	if p.atByte&1 != 0 {
+		p.atShiftLow |= 0xFF
+	}
+	p.atShiftHigh &= 0xFF00
+	if p.atByte&2 != 0 {
+		p.atShiftHigh |= 0xFF
+	}
+}
+
+func (p *PPU) backgroundCycle() {
+	if (p.cycle >= 2 && p.cycle <= 257) || (p.cycle >= 322 && p.cycle <= 337) {
+		p.shiftBackground()
+		if (p.cycle-1)%8 == 0 {
+			p.reloadBackground()
+		}
+	}
+
+	if p.cycle == 256 {
+		p.incrementY()
+	} else if p.cycle == 257 {
+		p.copyX()
+	} else if p.scanLine == 261 && p.cycle >= 280 && p.cycle <= 304 {
+		p.copyY()
+	}
+
+	if !(p.cycle >= 1 && p.cycle <= 256) && !(p.cycle >= 321 && p.cycle <= 336) {
+		return
+	}
+
+	switch (p.cycle - 1) % 8 {
+	case 0:
+		p.fetchNametable()
+	case 2:
+		p.fetchAttribute()
+	case 4:
+		p.fetchPatternLow()
+	case 6:
+		p.fetchPatternHigh()
+	case 7:
+		p.incrementX()
+	}
+}
+
+// backgroundPixel returns the 2 bit pattern value and palette for the pixel
+// under the beam.
+func (p *PPU) backgroundPixel(x int) (pixel byte, palette byte) {
+	if p.PPUMASK&0x08 == 0 || (x < 8 && p.PPUMASK&0x02 == 0) {
+		return 0, 0
+	}
+
+	mux := uint16(0x8000) >> p.fineX
+
+	if p.bgShiftLow&mux != 0 {
+		pixel |= 1
+	}
+	if p.bgShiftHigh&mux != 0 {
+		pixel |= 2
+	}
+	if p.atShiftLow&mux != 0 {
+		palette |= 1
+	}
+	if p.atShiftHigh&mux != 0 {
+		palette |= 2
+	}
+
+	return pixel, palette
+}
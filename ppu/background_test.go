@@ -0,0 +1,105 @@
+package ppu
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+const (
+	black = 0x0F
+	white = 0x30
+	red   = 0x16
+)
+
+// solidTile makes tile 1 of the left pattern table solid color 1, leaving
+// tile 0 transparent.
+func solidTile(p *PPU) {
+	for i := 0x10; i < 0x18; i++ {
+		*p.Memory[i] = 0xFF
+	}
+}
+
+func fillNametable(p *PPU, tile byte) {
+	for i := 0x2000; i < 0x23C0; i++ {
+		*p.Memory[i] = tile
+	}
+}
+
+func paletteColor(index byte) color.NRGBA {
+	c := Palette[index]
+	return color.NRGBA{c[0], c[1], c[2], 0xFF}
+}
+
+func checkPixel(t *testing.T, img image.Image, x, y int, want byte) {
+	if got := img.At(x, y); got != paletteColor(want) {
+		t.Errorf("Pixel %v,%v is %v, want %v", x, y, got, paletteColor(want))
+	}
+}
+
+func TestBackgroundRendering(t *testing.T) {
+	p, r := newTestPPU()
+	solidTile(p)
+	*p.Memory[0x3F00] = black
+	*p.Memory[0x3F01] = white
+	*p.Memory[0x2000+2*32+3] = 1 // Tile 1 at column 3, row 2
+
+	p.PPUMASK = 0x0A
+	img := runFrame(p, r)
+
+	checkPixel(t, img, 3*8, 2*8, white)
+	checkPixel(t, img, 3*8+7, 2*8+7, white)
+	checkPixel(t, img, 3*8-1, 2*8, black)
+	checkPixel(t, img, 4*8, 2*8, black)
+	checkPixel(t, img, 0, 0, black)
+}
+
+func TestBackgroundAttributes(t *testing.T) {
+	p, r := newTestPPU()
+	solidTile(p)
+	fillNametable(p, 1)
+	*p.Memory[0x3F01] = white
+	*p.Memory[0x3F0D] = red
+	*p.Memory[0x23C0] = 0x0C // Palette 3 for the top right 16x16 of the first block
+
+	p.PPUMASK = 0x0A
+	img := runFrame(p, r)
+
+	checkPixel(t, img, 0, 0, white)
+	checkPixel(t, img, 16, 0, red)
+	checkPixel(t, img, 31, 15, red)
+	checkPixel(t, img, 16, 16, white)
+}
+
+func TestBackgroundFineXScroll(t *testing.T) {
+	p, r := newTestPPU()
+	solidTile(p)
+	*p.Memory[0x3F00] = black
+	*p.Memory[0x3F01] = white
+	*p.Memory[0x2001] = 1 // Tile 1 at column 1
+
+	p.ReadPPUStatus(false)
+	p.WritePPUSCROLL(3)
+	p.WritePPUSCROLL(0)
+	p.PPUMASK = 0x0A
+	img := runFrame(p, r)
+
+	checkPixel(t, img, 4, 0, black)
+	checkPixel(t, img, 5, 0, white)
+	checkPixel(t, img, 12, 0, white)
+	checkPixel(t, img, 13, 0, black)
+}
+
+func TestBackgroundLeftColumnMask(t *testing.T) {
+	p, r := newTestPPU()
+	solidTile(p)
+	fillNametable(p, 1)
+	*p.Memory[0x3F00] = black
+	*p.Memory[0x3F01] = white
+
+	p.PPUMASK = 0x08
+	img := runFrame(p, r)
+
+	checkPixel(t, img, 7, 0, black)
+	checkPixel(t, img, 8, 0, white)
+}
@@ -0,0 +1,87 @@
+package ppu
+
+import (
+	"testing"
+
+	"github.com/evandigby/nesgo/nes"
+	"github.com/evandigby/nesgo/rom"
+)
+
+func TestNametableMirroring(t *testing.T) {
+	tests := []struct {
+		mode  rom.Mirroring
+		pages [4]int
+	}{
+		{rom.MirrorHorizontal, [4]int{0, 0, 1, 1}},
+		{rom.MirrorVertical, [4]int{0, 1, 0, 1}},
+		{rom.MirrorSingleA, [4]int{0, 0, 0, 0}},
+		{rom.MirrorSingleB, [4]int{1, 1, 1, 1}},
+		{rom.MirrorFourScreen, [4]int{0, 1, 2, 3}},
+	}
+
+	for _, test := range tests {
+		p, _ := newTestPPU()
+		p.SetMirroring(test.mode)
+		if p.Mirroring() != test.mode {
+			t.Errorf("%v: Mirroring() is %v", test.mode, p.Mirroring())
+		}
+
+		for table, page := range test.pages {
+			address := uint16(0x2000 + table*0x400 + 0x123)
+			value := byte(0x10 + table)
+			p.writeVRAM(address, value)
+
+			if got := *p.Nametable(page)[0x123]; got != value {
+				t.Errorf("%v: write to $%04X didn't land in page %v", test.mode, address, page)
+			}
+			// $3000-$3EFF mirrors $2000-$2EFF
+			if got := *p.Memory[address+0x1000]; got != value {
+				t.Errorf("%v: $%04X doesn't mirror $%04X", test.mode, address+0x1000, address)
+			}
+		}
+	}
+}
+
+func TestMapNametable(t *testing.T) {
+	p, _ := newTestPPU()
+	page := make([]*byte, 0x400)
+	for i := range page {
+		v := byte(i)
+		page[i] = &v
+	}
+
+	p.MapNametable(2, page)
+	if got := *p.Memory[0x2801]; got != 1 {
+		t.Errorf("$2801 is $%02X, want $01 from the mapped page", got)
+	}
+	if got := *p.Memory[0x3801]; got != 1 {
+		t.Errorf("$3801 is $%02X, want the $2801 mirror", got)
+	}
+	if p.Memory[0x2400] == page[0] || p.Memory[0x2C00] == page[0] {
+		t.Errorf("Mapping nametable 2 moved the tables around it")
+	}
+}
+
+// romNametables is a cartridge with CHR-ROM in place of nametable 1
+type romNametables struct{}
+
+func (m romNametables) Attach(n *nes.NES)                    {}
+func (m romNametables) Read(address uint16, debug bool) byte { return 0 }
+func (m romNametables) Write(address uint16, value byte)     {}
+func (m romNametables) WriteCHR(address uint16, value byte)  {}
+func (m romNametables) NametableIsROM(table int) bool        { return table == 1 }
+
+func TestROMNametableIgnoresWrites(t *testing.T) {
+	p, _ := newTestPPU()
+	p.SetMirroring(rom.MirrorVertical)
+	p.nes.Mapper = romNametables{}
+
+	p.writeVRAM(0x2000, 0x11)
+	p.writeVRAM(0x2400, 0x22)
+	if got := *p.Memory[0x2000]; got != 0x11 {
+		t.Errorf("$2000 is $%02X, want $11", got)
+	}
+	if got := *p.Memory[0x2400]; got != 0 {
+		t.Errorf("Write to a ROM nametable went through, $2400 is $%02X", got)
+	}
+}
@@ -0,0 +1,33 @@
+package ppu
+
+func (p *PPU) renderPixel() {
+	x := p.cycle - 1
+	bg, bgPalette := p.backgroundPixel(x)
+	sp, spPalette, behind, zero := p.spritePixel(x)
+
+	if zero && bg != 0 && x != 255 {
+		p.PPUSTATUS |= 0x40
+	}
+
+	addr := uint16(0x3F00)
+	if sp != 0 && (bg == 0 || !behind) {
+		addr = 0x3F10 | uint16(spPalette)<<2 | uint16(sp)
+	} else if bg != 0 {
+		addr |= uint16(bgPalette)<<2 | uint16(bg)
+	}
+
+	p.setPixel(x, p.scanLine, *p.Memory[addr])
+}
+
+func (p *PPU) setPixel(x, y int, color byte) {
+	if p.PPUMASK&0x01 != 0 {
+		color &= 0x30
+	}
+
+	c := Palette[color&0x3F]
+	i := p.frame.PixOffset(x, y)
+	p.frame.Pix[i] = c[0]
+	p.frame.Pix[i+1] = c[1]
+	p.frame.Pix[i+2] = c[2]
+	p.frame.Pix[i+3] = 0xFF
+}
@@ -25,29 +25,54 @@ type PPU struct {
 	Memory []*byte
 	OAM    []*byte
 
-	vramAddr  uint16
-	tvramAddr uint16
+	nametables []*byte
+	mirroring  rom.Mirroring
+
+	// Internal scroll registers. vramAddr (v) is the current VRAM address,
+	// tvramAddr (t) the address latched by PPUCTRL/PPUSCROLL/PPUADDR writes,
+	// fineX (x) the fine horizontal scroll and writeToggle (w) the shared
+	// first/second write latch of PPUSCROLL and PPUADDR.
+	vramAddr    uint16
+	tvramAddr   uint16
+	fineX       byte
+	writeToggle bool
+
+	// readBuffer holds the result of the previous PPUDATA read
+	readBuffer byte
 
 	renderer Renderer
-	rom      rom.ROM
-
-	cycle        int
-	scanLine     int
-	odd          bool
-	nmi          bool
-	rendering    bool
-	scrollToggle bool
-	scrollX      byte
-	scrollY      byte
-	addrToggle   bool
-	addr         uint16
+
+	cycle     int
+	scanLine  int
+	odd       bool
+	nmi       bool
+	rendering bool
+
+	ntByte      byte
+	atByte      byte
+	bgLow       byte
+	bgHigh      byte
+	bgShiftLow  uint16
+	bgShiftHigh uint16
+	atShiftLow  uint16
+	atShiftHigh uint16
+
+	secondaryOAM   [maxSprites * 4]byte
+	spritesFound   int
+	spriteCount    int
+	spriteZeroNext bool
+	spriteZeroLine bool
+	spriteLow      [maxSprites]byte
+	spriteHigh     [maxSprites]byte
+	spriteAttr     [maxSprites]byte
+	spriteX        [maxSprites]byte
 
 	*Registers
 
 	frame *image.NRGBA
 }
 
-func NewPPU(n *nes.NES, sync chan int, rom rom.ROM, renderer Renderer) *PPU {
+func NewPPU(n *nes.NES, sync chan int, renderer Renderer) *PPU {
 	tm := make([]byte, 0x4000)
 	m := make([]*byte, 0x4000)
 
@@ -55,17 +80,22 @@ func NewPPU(n *nes.NES, sync chan int, rom rom.ROM, renderer Renderer) *PPU {
 		m[i] = &tm[i]
 	}
 
-	chrRom := rom.CharRom()
-	for i := range chrRom {
-		m[i] = chrRom[i]
+	// Nametable RAM. Only 2KB is inside the console, the rest is for
+	// cartridges wired for four screen mirroring.
+	tnt := make([]byte, 0x1000)
+	nt := make([]*byte, 0x1000)
+	for i := range nt {
+		nt[i] = &tnt[i]
 	}
 
-	// Mirror some Memory
-	for i := 0x2000; i < 0x2F00; i++ {
-		m[i+0x1000] = m[i]
-	}
-	for i := 0x3F00; i < 0x3F20; i++ {
-		m[i+0x0020] = m[i]
+	// Palette RAM is 32 bytes mirrored up to $3FFF. The sprite backdrop
+	// entries $3F10/$14/$18/$1C are aliases of $3F00/$04/$08/$0C.
+	for i := 0x3F00; i < 0x4000; i++ {
+		a := i & 0x1F
+		if a&0x13 == 0x10 {
+			a &^= 0x10
+		}
+		m[i] = m[0x3F00+a]
 	}
 
 	toam := make([]byte, 0x100)
@@ -76,17 +106,21 @@ func NewPPU(n *nes.NES, sync chan int, rom rom.ROM, renderer Renderer) *PPU {
 	}
 
 	ppu := &PPU{
-		nes:       n,
-		sync:      sync,
-		Memory:    m,
-		OAM:       oam,
-		renderer:  renderer,
-		rom:       rom,
-		Registers: &Registers{},
+		nes:        n,
+		sync:       sync,
+		Memory:     m,
+		OAM:        oam,
+		nametables: nt,
+		renderer:   renderer,
+		Registers:  &Registers{},
+		frame:      image.NewNRGBA(image.Rect(0, 0, 256, 240)),
 	}
 
+	ppu.SetMirroring(rom.MirrorHorizontal)
+	n.PPU = ppu
+
 	n.MemoryMap = nes.MemoryMap{
-		0x2000: &MappedRegister{func(debug bool) byte { return ppu.PPUCTRL }, func(val byte) { ppu.PPUCTRL = val }},
+		0x2000: &MappedRegister{func(debug bool) byte { return ppu.PPUCTRL }, ppu.WritePPUCTRL},
 		0x2001: &MappedRegister{func(debug bool) byte { return ppu.PPUMASK }, func(val byte) { ppu.PPUMASK = val }},
 		0x2002: &MappedRegister{ppu.ReadPPUStatus, func(val byte) { ppu.PPUSTATUS = val }},
 		0x2003: &MappedRegister{func(debug bool) byte { return ppu.OAMADDR }, func(val byte) { ppu.OAMADDR = val }},
@@ -100,6 +134,99 @@ func NewPPU(n *nes.NES, sync chan int, rom rom.ROM, renderer Renderer) *PPU {
 	return ppu
 }
 
+// updateNMI drives the CPU's /NMI line, which is asserted while both the
+// vblank flag and the PPUCTRL NMI enable are set.
+func (p *PPU) updateNMI() {
+	nmi := p.PPUSTATUS&0x80 != 0 && p.PPUCTRL&0x80 != 0
+	if nmi == p.nmi {
+		return
+	}
+
+	p.nmi = nmi
+	if p.nes.Interrupts != nil {
+		p.nes.Interrupts.SetNMI(nmi)
+	}
+}
+
+func (p *PPU) WritePPUCTRL(value byte) {
+	p.PPUCTRL = value
+	p.tvramAddr = (p.tvramAddr & 0xF3FF) | (uint16(value&3) << 10)
+	p.updateNMI()
+}
+
+// nametableLayouts maps each of the four logical nametables to a 1KB page of
+// nametable RAM.
+var nametableLayouts = map[rom.Mirroring][4]int{
+	rom.MirrorHorizontal: {0, 0, 1, 1},
+	rom.MirrorVertical:   {0, 1, 0, 1},
+	rom.MirrorSingleA:    {0, 0, 0, 0},
+	rom.MirrorSingleB:    {1, 1, 1, 1},
+	rom.MirrorFourScreen: {0, 1, 2, 3},
+}
+
+// SetMirroring points $2000-$3EFF at nametable RAM according to the layout.
+// Mappers call this to switch mirroring at runtime.
+func (p *PPU) SetMirroring(mode rom.Mirroring) {
+	layout, ok := nametableLayouts[mode]
+	if !ok {
+		return
+	}
+
+	for addr := 0x2000; addr < 0x3F00; addr++ {
+		table := ((addr - 0x2000) / 0x400) % 4
+		p.Memory[addr] = p.nametables[layout[table]*0x400+addr%0x400]
+	}
+	p.mirroring = mode
+}
+
+// Nametable returns a 1KB page of nametable RAM
+func (p *PPU) Nametable(page int) []*byte {
+	return p.nametables[page*0x400 : (page+1)*0x400]
+}
+
+// MapNametable points one of the four logical nametables, and its mirror at
+// $3000, at a 1KB page. The page doesn't have to be nametable RAM.
+func (p *PPU) MapNametable(table int, page []*byte) {
+	for addr := 0x2000 + table*0x400; addr < 0x3F00; addr += 0x1000 {
+		for i := 0; i < 0x400 && addr+i < 0x3F00; i++ {
+			p.Memory[addr+i] = page[i]
+		}
+	}
+}
+
+func (p *PPU) Mirroring() rom.Mirroring {
+	return p.mirroring
+}
+
+// read fetches from VRAM, putting the address on the bus for any cartridge
+// that is watching it.
+func (p *PPU) read(addr uint16) byte {
+	val := *p.Memory[addr]
+	p.busAddress(addr)
+	return val
+}
+
+// fetch is a rendering fetch, which cartridges that take part in rendering
+// can replace the result of.
+func (p *PPU) fetch(kind nes.PPUFetch, addr uint16) byte {
+	val := p.read(addr)
+	if f, ok := p.nes.Mapper.(nes.PPUFetcher); ok {
+		val = f.Fetch(kind, addr, val)
+	}
+	return val
+}
+
+func (p *PPU) busAddress(addr uint16) {
+	if w, ok := p.nes.Mapper.(nes.PPUWatcher); ok {
+		w.PPUAddress(addr)
+	}
+}
+
+// PatternTables is the $0000-$1FFF window the cartridge maps CHR banks into
+func (p *PPU) PatternTables() []*byte {
+	return p.Memory[0x0000:0x2000]
+}
+
 func (p *PPU) ReadPPUStatus(debug bool) byte {
 	val := p.PPUSTATUS
 
@@ -107,7 +234,8 @@ func (p *PPU) ReadPPUStatus(debug bool) byte {
 		return val
 	}
 	p.PPUSTATUS &= 0x7F
-	p.scrollToggle = false
+	p.writeToggle = false
+	p.updateNMI()
 
 	return val
 }
@@ -124,49 +252,85 @@ func (p *PPU) ReadOAMDATA(debug bool) byte {
 }
 
 func (p *PPU) WritePPUSCROLL(value byte) {
-	if !p.scrollToggle {
-		p.scrollX = value
+	if !p.writeToggle {
+		p.tvramAddr = (p.tvramAddr & 0xFFE0) | uint16(value>>3)
+		p.fineX = value & 7
 	} else {
-		p.scrollY = value
+		p.tvramAddr = (p.tvramAddr & 0x8C1F) | (uint16(value&7) << 12) | (uint16(value&0xF8) << 2)
 	}
 
-	p.scrollToggle = !p.scrollToggle
+	p.writeToggle = !p.writeToggle
 }
 
 func (p *PPU) WritePPUADDR(value byte) {
-	if !p.addrToggle {
-		p.addr &= 0x00FF
-		p.addr |= uint16(value) << 8
+	if !p.writeToggle {
+		p.tvramAddr = (p.tvramAddr & 0x80FF) | (uint16(value&0x3F) << 8)
 	} else {
-		p.addr &= 0xFF00
-		p.addr |= uint16(value)
+		p.tvramAddr = (p.tvramAddr & 0xFF00) | uint16(value)
+		p.vramAddr = p.tvramAddr
+		p.busAddress(p.vramAddr & 0x3FFF)
 	}
 
-	p.addrToggle = !p.addrToggle
+	p.writeToggle = !p.writeToggle
 }
 
-func (p *PPU) WritePPUDATA(value byte) {
-	*p.Memory[p.addr] = value
-	if p.PPUCTRL&4 > 0 {
-		p.addr += 32
+// incrementVRAMAddr advances v after a PPUDATA access. While rendering, the
+// access instead triggers both a coarse X and a Y increment, as on hardware.
+func (p *PPU) incrementVRAMAddr() {
+	if p.renderingEnabled() && (p.scanLine < 240 || p.scanLine == 261) {
+		p.incrementX()
+		p.incrementY()
+	} else if p.PPUCTRL&4 > 0 {
+		p.vramAddr += 32
 	} else {
-		p.addr++
+		p.vramAddr++
+	}
+}
+
+func (p *PPU) WritePPUDATA(value byte) {
+	addr := p.vramAddr & 0x3FFF
+	p.busAddress(addr)
+	switch {
+	case addr < 0x2000 && p.nes.Mapper != nil:
+		p.nes.Mapper.WriteCHR(addr, value)
+	case addr < 0x3F00 && p.nametableIsROM(addr):
+		// ROM ignores the write
+	default:
+		*p.Memory[addr] = value
 	}
+	p.incrementVRAMAddr()
 }
 
+// nametableIsROM reports whether the cartridge has CHR-ROM in place of the
+// nametable at addr
+func (p *PPU) nametableIsROM(addr uint16) bool {
+	m, ok := p.nes.Mapper.(nes.NametableROM)
+	return ok && m.NametableIsROM(int(addr-0x2000)/0x400%4)
+}
+
+// ReadPPUDATA returns the contents of the internal read buffer and refills it
+// from v. Palette reads are returned immediately, but still refill the buffer
+// with the nametable byte "underneath" the palette.
 func (p *PPU) ReadPPUDATA(debug bool) byte {
-	val := *p.Memory[p.addr]
+	addr := p.vramAddr & 0x3FFF
+
+	val := p.readBuffer
+	if addr >= 0x3F00 {
+		val = *p.Memory[addr]
+	}
 
 	if debug {
 		return val
 	}
 
-	if p.PPUCTRL&4 > 0 {
-		p.addr += 32
+	if addr >= 0x3F00 {
+		p.readBuffer = p.read(addr - 0x1000)
 	} else {
-		p.addr++
+		p.readBuffer = p.read(addr)
 	}
 
+	p.incrementVRAMAddr()
+
 	return val
 }
 
@@ -215,43 +379,51 @@ func (p *PPU) Reset() {
 }
 
 func (p *PPU) visible() {
-	if p.cycle == 0 {
-
-	} else if p.cycle > 0 && p.cycle <= 256 {
+	if p.renderingEnabled() {
+		p.backgroundCycle()
+		p.spriteCycle()
+	}
 
+	if p.cycle >= 1 && p.cycle <= 256 {
+		p.renderPixel()
 	} else if p.cycle > 256 && p.cycle <= 320 {
 		p.OAMADDR = 0x00
-	} else if p.cycle > 320 && p.cycle <= 336 {
-
-	} else if p.cycle > 336 && p.cycle <= 340 {
-
 	}
 }
 
 func (p *PPU) vBlank() {
-	if p.cycle == 1 {
+	if p.scanLine == 241 && p.cycle == 1 {
 		p.PPUSTATUS |= 0x80
+		p.updateNMI()
 	}
 }
 
 func (p *PPU) preRender() {
 	if p.cycle == 1 {
-		p.PPUSTATUS &= 0x7F
+		p.PPUSTATUS &= 0x1F
+		p.updateNMI()
 		p.frame = image.NewNRGBA(image.Rect(0, 0, 256, 240))
 	} else if p.cycle > 256 && p.cycle <= 320 {
 		p.OAMADDR = 0x00
 	}
+
+	if p.renderingEnabled() {
+		p.backgroundCycle()
+		p.spriteCycle()
+	}
 }
 
 func (p *PPU) postRender() {
-	p.renderer.Render(p.frame)
+	if p.cycle == 0 {
+		p.renderer.Render(p.frame)
+	}
 }
 
 func (p *PPU) runCycle() {
 	if p.scanLine == 261 {
 		p.rendering = true
 		p.preRender()
-	} else if p.scanLine > 0 && p.scanLine <= 239 {
+	} else if p.scanLine >= 0 && p.scanLine <= 239 {
 		p.rendering = true
 		p.visible()
 	} else if p.scanLine == 240 {
@@ -263,25 +435,37 @@ func (p *PPU) runCycle() {
 	}
 }
 
-func (p *PPU) execute() {
-	p.PowerOn()
+// tick runs one PPU dot and returns the cycle it ran
+func (p *PPU) tick() int {
+	if p.cycle > 340 {
+		p.cycle = 0
+		p.scanLine++
 
-	for {
-		<-p.sync
-		if p.cycle > 340 {
-			p.cycle = 0
-			p.scanLine++
-
-			if p.scanLine > 261 {
-				p.scanLine = -1
-			}
+		if p.scanLine > 261 {
+			p.scanLine = 0
+			p.odd = !p.odd
 		}
+	}
 
-		p.runCycle()
+	p.runCycle()
+	cycle := p.cycle
+	p.cycle++
 
-		p.sync <- p.cycle
+	// The idle dot at the end of the pre-render line is skipped on odd frames
+	if p.scanLine == 261 && p.cycle == 340 && p.odd && p.renderingEnabled() {
 		p.cycle++
 	}
+
+	return cycle
+}
+
+func (p *PPU) execute() {
+	p.PowerOn()
+
+	for {
+		<-p.sync
+		p.sync <- p.tick()
+	}
 }
 
 func (p *PPU) Run() {
@@ -0,0 +1,198 @@
+package ppu
+
+import (
+	"image"
+	"testing"
+
+	"github.com/evandigby/nesgo/nes"
+)
+
+type testRenderer struct {
+	frames int
+	last   image.Image
+}
+
+func (r *testRenderer) Render(img image.Image) {
+	r.frames++
+	r.last = img
+}
+
+func newTestPPU() (*PPU, *testRenderer) {
+	r := &testRenderer{}
+	p := NewPPU(nes.NewNES(), nil, r)
+	p.PowerOn()
+	return p, r
+}
+
+// setAddress points v at address through PPUADDR
+func (p *PPU) setAddress(address uint16) {
+	p.ReadPPUStatus(false)
+	p.WritePPUADDR(byte(address >> 8))
+	p.WritePPUADDR(byte(address))
+}
+
+func (p *PPU) writeVRAM(address uint16, values ...byte) {
+	p.setAddress(address)
+	for _, v := range values {
+		p.WritePPUDATA(v)
+	}
+}
+
+func TestPPUDATAReadIsBuffered(t *testing.T) {
+	p, _ := newTestPPU()
+	p.writeVRAM(0x2000, 0xAA, 0xBB)
+
+	p.setAddress(0x2000)
+	want := []byte{0x00, 0xAA, 0xBB}
+	for i, w := range want {
+		if got := p.ReadPPUDATA(false); got != w {
+			t.Errorf("Read %v returned $%02X, want $%02X", i, got, w)
+		}
+	}
+}
+
+// Palette reads skip the buffer, but refill it with the nametable byte the
+// palette sits on top of.
+func TestPPUDATAPaletteRead(t *testing.T) {
+	p, _ := newTestPPU()
+	p.writeVRAM(0x2F00, 0x55)
+	p.writeVRAM(0x3F00, 0x21)
+
+	p.setAddress(0x3F00)
+	if got := p.ReadPPUDATA(false); got != 0x21 {
+		t.Errorf("Palette read $%02X, want $21 straight away", got)
+	}
+
+	p.setAddress(0x2000)
+	if got := p.ReadPPUDATA(false); got != 0x55 {
+		t.Errorf("Buffer holds $%02X after the palette read, want $55 from $2F00", got)
+	}
+}
+
+func TestPPUDATADebugReadLeavesBuffer(t *testing.T) {
+	p, _ := newTestPPU()
+	p.writeVRAM(0x2000, 0xAA, 0xBB)
+
+	p.setAddress(0x2000)
+	p.ReadPPUDATA(false)
+	p.ReadPPUDATA(true)
+	if got := p.ReadPPUDATA(false); got != 0xAA {
+		t.Errorf("Read $%02X after a debug read, want $AA", got)
+	}
+}
+
+func TestPPUDATAIncrement(t *testing.T) {
+	p, _ := newTestPPU()
+
+	p.WritePPUCTRL(0x04)
+	p.writeVRAM(0x2000, 0x01, 0x02)
+	if got := *p.Memory[0x2020]; got != 0x02 {
+		t.Errorf("Second write with +32 increment landed elsewhere, $2020 = $%02X", got)
+	}
+}
+
+func TestPaletteMirroring(t *testing.T) {
+	p, _ := newTestPPU()
+
+	mirrors := []struct {
+		write, read uint16
+	}{
+		{0x3F10, 0x3F00},
+		{0x3F14, 0x3F04},
+		{0x3F18, 0x3F08},
+		{0x3F1C, 0x3F0C},
+		{0x3F00, 0x3F10},
+		{0x3F01, 0x3F21},
+		{0x3F1F, 0x3FFF},
+	}
+
+	for i, m := range mirrors {
+		v := byte(0x10 + i)
+		p.writeVRAM(m.write, v)
+		if got := *p.Memory[m.read]; got != v {
+			t.Errorf("Wrote $%02X to $%04X, $%04X reads $%02X", v, m.write, m.read, got)
+		}
+	}
+
+	// The other sprite palette entries are their own
+	p.writeVRAM(0x3F01, 0x01)
+	p.writeVRAM(0x3F11, 0x02)
+	if got := *p.Memory[0x3F01]; got != 0x01 {
+		t.Errorf("$3F11 overwrote $3F01")
+	}
+}
+
+func TestVBlankNMI(t *testing.T) {
+	p, _ := newTestPPU()
+	nmi := &testInterrupts{}
+	p.nes.Interrupts = nmi
+
+	p.WritePPUCTRL(0x80)
+	runUntil(p, 241, 2)
+	if p.PPUSTATUS&0x80 == 0 || !nmi.nmi {
+		t.Fatalf("No vblank NMI at 241,1")
+	}
+
+	p.ReadPPUStatus(false)
+	if nmi.nmi {
+		t.Errorf("Reading PPUSTATUS didn't release /NMI")
+	}
+}
+
+type testInterrupts struct {
+	nmi bool
+}
+
+func (i *testInterrupts) SetNMI(active bool)                       { i.nmi = active }
+func (i *testInterrupts) SetIRQ(source nes.IRQSource, active bool) {}
+
+// runUntil ticks the PPU until it is about to run the given dot
+func runUntil(p *PPU, scanLine, cycle int) {
+	for limit := 0; limit < 341*262*2; limit++ {
+		if p.scanLine == scanLine && p.cycle == cycle {
+			return
+		}
+		p.tick()
+	}
+	panic("PPU never reached the dot")
+}
+
+// runFrame renders a frame starting from the pre-render line
+func runFrame(p *PPU, r *testRenderer) image.Image {
+	p.scanLine, p.cycle = 261, 0
+	frames := r.frames
+	for r.frames == frames {
+		p.tick()
+	}
+	return r.last
+}
+
+func TestScrollRegisters(t *testing.T) {
+	p, _ := newTestPPU()
+
+	p.WritePPUCTRL(0x03)
+	p.ReadPPUStatus(false)
+	p.WritePPUSCROLL(0x7D)
+	p.WritePPUSCROLL(0x5E)
+	if p.tvramAddr != 0x6D6F || p.fineX != 5 {
+		t.Errorf("After PPUSCROLL t = $%04X, x = %v, want $6D6F, 5", p.tvramAddr, p.fineX)
+	}
+
+	p.WritePPUADDR(0x04)
+	if p.tvramAddr != 0x046F || !p.writeToggle {
+		t.Errorf("After first PPUADDR t = $%04X, w = %v, want $046F, true", p.tvramAddr, p.writeToggle)
+	}
+
+	p.WritePPUADDR(0x3E)
+	if p.tvramAddr != 0x043E || p.vramAddr != 0x043E || p.writeToggle {
+		t.Errorf("After second PPUADDR t = $%04X, v = $%04X, w = %v, want $043E, $043E, false", p.tvramAddr, p.vramAddr, p.writeToggle)
+	}
+
+	// Reading PPUSTATUS resets the toggle between writes
+	p.WritePPUSCROLL(0x08)
+	p.ReadPPUStatus(false)
+	p.WritePPUSCROLL(0x10)
+	if p.tvramAddr&0x1F != 0x02 {
+		t.Errorf("Second write after PPUSTATUS read set coarse Y instead of coarse X")
+	}
+}
@@ -0,0 +1,157 @@
+package ppu
+
+import "github.com/evandigby/nesgo/nes"
+
+const maxSprites = 8
+
+func (p *PPU) spriteHeight() int {
+	if p.PPUCTRL&0x20 != 0 {
+		return 16
+	}
+	return 8
+}
+
+// evaluateSprites fills secondary OAM with the sprites that fall on the next
+// scanline. Once eight sprites have been found the hardware keeps scanning for
+// an overflow, but increments the byte offset along with the sprite index, so
+// the overflow flag is famously unreliable. That bug is reproduced here.
+func (p *PPU) evaluateSprites() {
+	for i := range p.secondaryOAM {
+		p.secondaryOAM[i] = 0xFF
+	}
+
+	height := p.spriteHeight()
+	inRange := func(y byte) bool {
+		row := p.scanLine - int(y)
+		return row >= 0 && row < height
+	}
+
+	found := 0
+	n := 0
+	p.spriteZeroNext = false
+	for ; n < 64 && found < maxSprites; n++ {
+		y := *p.OAM[n*4]
+		if !inRange(y) {
+			continue
+		}
+
+		for b := 0; b < 4; b++ {
+			p.secondaryOAM[found*4+b] = *p.OAM[n*4+b]
+		}
+		if n == 0 {
+			p.spriteZeroNext = true
+		}
+		found++
+	}
+	p.spritesFound = found
+
+	m := 0
+	for n < 64 {
+		if inRange(*p.OAM[n*4+m]) {
+			p.PPUSTATUS |= 0x20
+			break
+		}
+		n++
+		m = (m + 1) & 3
+	}
+}
+
+func (p *PPU) spritePatternAddress(tile byte, attr byte, row int) uint16 {
+	if attr&0x80 != 0 {
+		row = p.spriteHeight() - 1 - row
+	}
+
+	var base uint16
+	if p.spriteHeight() == 16 {
+		base = uint16(tile&1) << 12
+		tile &= 0xFE
+		if row > 7 {
+			tile++
+			row -= 8
+		}
+	} else {
+		base = uint16(p.PPUCTRL&0x08) << 9
+	}
+
+	return base + uint16(tile)*16 + uint16(row)
+}
+
+func reverseBits(b byte) byte {
+	b = (b&0xF0)>>4 | (b&0x0F)<<4
+	b = (b&0xCC)>>2 | (b&0x33)<<2
+	b = (b&0xAA)>>1 | (b&0x55)<<1
+	return b
+}
+
+// fetchSprite loads the pattern for one secondary OAM slot. Slots are fetched
+// over dots 257-320, eight dots each. Empty slots still fetch tile $FF.
+func (p *PPU) fetchSprite(slot int) {
+	y := p.secondaryOAM[slot*4]
+	tile := p.secondaryOAM[slot*4+1]
+	attr := p.secondaryOAM[slot*4+2]
+	x := p.secondaryOAM[slot*4+3]
+
+	row := p.scanLine - int(y)
+	if slot >= p.spritesFound {
+		row = 0
+	}
+
+	addr := p.spritePatternAddress(tile, attr, row)
+	low := p.fetch(nes.FetchSprite, addr)
+	high := p.fetch(nes.FetchSprite, addr+8)
+
+	if slot >= p.spritesFound {
+		low, high = 0, 0
+	} else if attr&0x40 != 0 {
+		low, high = reverseBits(low), reverseBits(high)
+	}
+
+	p.spriteLow[slot] = low
+	p.spriteHigh[slot] = high
+	p.spriteAttr[slot] = attr
+	p.spriteX[slot] = x
+}
+
+func (p *PPU) spriteCycle() {
+	if p.scanLine == 261 {
+		p.spritesFound = 0
+		p.spriteZeroNext = false
+	} else if p.cycle == 256 {
+		p.evaluateSprites()
+	}
+
+	if p.cycle == 257 {
+		p.spriteCount = p.spritesFound
+		p.spriteZeroLine = p.spriteZeroNext
+	}
+
+	if p.cycle >= 257 && p.cycle <= 320 && (p.cycle-257)%8 == 7 {
+		p.fetchSprite((p.cycle - 257) / 8)
+	}
+}
+
+// spritePixel returns the front-most opaque sprite pixel under the beam, if
+// it is behind the background, and if it came from sprite 0.
+func (p *PPU) spritePixel(x int) (pixel byte, palette byte, behind bool, zero bool) {
+	if p.PPUMASK&0x10 == 0 || (x < 8 && p.PPUMASK&0x04 == 0) {
+		return 0, 0, false, false
+	}
+
+	for i := 0; i < p.spriteCount; i++ {
+		offset := x - int(p.spriteX[i])
+		if offset < 0 || offset > 7 {
+			continue
+		}
+
+		bit := uint(7 - offset)
+		pixel = (p.spriteLow[i]>>bit)&1 | ((p.spriteHigh[i]>>bit)&1)<<1
+		if pixel == 0 {
+			continue
+		}
+
+		attr := p.spriteAttr[i]
+		return pixel, attr & 3, attr&0x20 != 0, i == 0 && p.spriteZeroLine
+	}
+
+	return 0, 0, false, false
+}
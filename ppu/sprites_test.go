@@ -0,0 +1,194 @@
+package ppu
+
+import "testing"
+
+// clearOAM moves every sprite below the screen
+func clearOAM(p *PPU) {
+	for _, b := range p.OAM {
+		*b = 0xFF
+	}
+}
+
+func setSprite(p *PPU, n int, y, tile, attr, x byte) {
+	*p.OAM[n*4] = y
+	*p.OAM[n*4+1] = tile
+	*p.OAM[n*4+2] = attr
+	*p.OAM[n*4+3] = x
+}
+
+func TestSpriteRendering(t *testing.T) {
+	p, r := newTestPPU()
+	solidTile(p)
+	clearOAM(p)
+	*p.Memory[0x3F00] = black
+	*p.Memory[0x3F11] = red
+	setSprite(p, 0, 20, 1, 0, 40)
+
+	p.PPUMASK = 0x14
+	img := runFrame(p, r)
+
+	// Sprites are drawn a line below their Y
+	checkPixel(t, img, 40, 21, red)
+	checkPixel(t, img, 47, 28, red)
+	checkPixel(t, img, 40, 20, black)
+	checkPixel(t, img, 48, 21, black)
+	checkPixel(t, img, 40, 29, black)
+}
+
+func TestSpriteFlipping(t *testing.T) {
+	p, r := newTestPPU()
+	clearOAM(p)
+	*p.Memory[0x10] = 0x80 // Tile 1 is a single dot in its top left corner
+	*p.Memory[0x3F00] = black
+	*p.Memory[0x3F11] = red
+
+	setSprite(p, 0, 20, 1, 0x00, 40)
+	setSprite(p, 1, 20, 1, 0x40, 60)
+	setSprite(p, 2, 20, 1, 0x80, 80)
+
+	p.PPUMASK = 0x14
+	img := runFrame(p, r)
+
+	checkPixel(t, img, 40, 21, red)
+	checkPixel(t, img, 67, 21, red)
+	checkPixel(t, img, 80, 28, red)
+	checkPixel(t, img, 80, 21, black)
+}
+
+func TestSpritePriority(t *testing.T) {
+	p, r := newTestPPU()
+	solidTile(p)
+	clearOAM(p)
+	*p.Memory[0x2000+3*32+5] = 1 // Background under the sprites
+	*p.Memory[0x2000+3*32+6] = 1
+	*p.Memory[0x3F01] = white
+	*p.Memory[0x3F11] = red
+
+	setSprite(p, 0, 23, 1, 0x20, 40) // Behind the background
+	setSprite(p, 1, 23, 1, 0x00, 44) // In front, but under sprite 0
+	setSprite(p, 2, 23, 1, 0x00, 52) // In front
+
+	p.PPUMASK = 0x1E
+	img := runFrame(p, r)
+
+	checkPixel(t, img, 40, 24, white)
+	// The first opaque sprite wins before the background priority bit is
+	// looked at, so sprite 0 hides sprite 1 behind the background too
+	checkPixel(t, img, 47, 24, white)
+	checkPixel(t, img, 48, 24, red)
+	checkPixel(t, img, 52, 24, red)
+}
+
+func TestSpriteZeroHit(t *testing.T) {
+	p, r := newTestPPU()
+	solidTile(p)
+	fillNametable(p, 1)
+	clearOAM(p)
+	setSprite(p, 0, 20, 1, 0, 40)
+
+	p.PPUMASK = 0x1E
+	p.scanLine, p.cycle = 261, 0
+	runUntil(p, 21, 40)
+	if p.PPUSTATUS&0x40 != 0 {
+		t.Fatalf("Sprite 0 hit before sprite 0 was drawn")
+	}
+
+	runFrame(p, r)
+	if p.PPUSTATUS&0x40 == 0 {
+		t.Fatalf("No sprite 0 hit")
+	}
+
+	// Cleared on the pre-render line
+	runUntil(p, 261, 2)
+	if p.PPUSTATUS&0x40 != 0 {
+		t.Errorf("Sprite 0 hit not cleared on the pre-render line")
+	}
+}
+
+func TestSpriteZeroHitNeedsOpaqueBackground(t *testing.T) {
+	tests := []struct {
+		name string
+		mask byte
+		x    byte
+	}{
+		{"transparent background", 0x1E, 40},
+		{"background hidden", 0x14, 40},
+		{"left column clipped", 0x18, 0},
+		{"x = 255", 0x1E, 255},
+	}
+
+	for _, test := range tests {
+		p, r := newTestPPU()
+		solidTile(p)
+		clearOAM(p)
+		if test.name != "transparent background" {
+			fillNametable(p, 1)
+		}
+		setSprite(p, 0, 20, 1, 0, test.x)
+
+		p.PPUMASK = test.mask
+		runFrame(p, r)
+		if p.PPUSTATUS&0x40 != 0 {
+			t.Errorf("%v: unexpected sprite 0 hit", test.name)
+		}
+	}
+}
+
+func TestSpriteOverflow(t *testing.T) {
+	for _, count := range []int{8, 9} {
+		p, r := newTestPPU()
+		solidTile(p)
+		clearOAM(p)
+		for i := 0; i < count; i++ {
+			setSprite(p, i, 50, 1, 0, byte(i*16))
+		}
+
+		p.PPUMASK = 0x18
+		runFrame(p, r)
+
+		overflow := p.PPUSTATUS&0x20 != 0
+		if overflow != (count > 8) {
+			t.Errorf("%v sprites on a line: overflow %v", count, overflow)
+		}
+	}
+}
+
+// Only the first eight sprites on a line are drawn
+func TestSpriteLimit(t *testing.T) {
+	p, r := newTestPPU()
+	solidTile(p)
+	clearOAM(p)
+	*p.Memory[0x3F00] = black
+	*p.Memory[0x3F11] = red
+	for i := 0; i < 9; i++ {
+		setSprite(p, i, 50, 1, 0, byte(i*16))
+	}
+
+	p.PPUMASK = 0x14
+	img := runFrame(p, r)
+
+	checkPixel(t, img, 7*16, 51, red)
+	checkPixel(t, img, 8*16, 51, black)
+}
+
+func TestTallSprites(t *testing.T) {
+	p, r := newTestPPU()
+	clearOAM(p)
+	// Tile $02 of the right pattern table holds the top, $03 the bottom
+	for i := 0; i < 8; i++ {
+		*p.Memory[0x1020+i] = 0xFF
+	}
+	*p.Memory[0x3F00] = black
+	*p.Memory[0x3F11] = red
+	setSprite(p, 0, 20, 0x03, 0, 40)
+	setSprite(p, 1, 20, 0x03, 0x80, 60) // Flipped, top and bottom swap
+
+	p.WritePPUCTRL(0x20)
+	p.PPUMASK = 0x14
+	img := runFrame(p, r)
+
+	checkPixel(t, img, 40, 21, red)
+	checkPixel(t, img, 40, 29, black)
+	checkPixel(t, img, 60, 21, black)
+	checkPixel(t, img, 60, 29, red)
+}
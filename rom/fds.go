@@ -0,0 +1,84 @@
+package rom
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+const (
+	fdsHeaderSize = 16
+	fdsSideSize   = 65500
+	fdsRAMSize    = 0x8000
+)
+
+// FDSMapper is the mapper number iNES reserves for the Famicom Disk System
+const FDSMapper = 20
+
+// FDS is a Famicom Disk System disk image, with or without the fwNES header.
+// It has no PRG or CHR-ROM of its own: the RAM adapter runs the BIOS, which
+// loads the game from the disk sides into RAM.
+type FDS struct {
+	sides [][]byte
+}
+
+func (r *FDS) Trainer() []*byte           { return []*byte{} }
+func (r *FDS) Pages() int                 { return 0 }
+func (r *FDS) CharPages() int             { return 0 }
+func (r *FDS) ProgramRom() []*byte        { return []*byte{} }
+func (r *FDS) CharRom() []*byte           { return []*byte{} }
+func (r *FDS) PlayChoiceInstRom() []*byte { return []*byte{} }
+func (r *FDS) PlayChoicePRom() []*byte    { return []*byte{} }
+func (r *FDS) Mirroring() Mirroring       { return MirrorHorizontal }
+func (r *FDS) Mapper() int                { return FDSMapper }
+func (r *FDS) Submapper() int             { return 0 }
+func (r *FDS) NES2() bool                 { return false }
+func (r *FDS) PRGRAMSize() int            { return fdsRAMSize }
+func (r *FDS) PRGNVRAMSize() int          { return 0 }
+func (r *FDS) CHRRAMSize() int            { return defaultRAMSize }
+func (r *FDS) CHRNVRAMSize() int          { return 0 }
+func (r *FDS) Timing() Timing             { return TimingNTSC }
+func (r *FDS) Console() Console           { return ConsoleNES }
+func (r *FDS) ExpansionDevice() int       { return 0 }
+
+// Sides returns the raw data of each disk side, without gaps or CRCs
+func (r *FDS) Sides() [][]byte { return r.sides }
+
+func NewFDS(reader io.Reader) (ROM, error) {
+	raw, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return &FDS{}, errors.New("Unable to read FDS format from stream")
+	}
+
+	// The fwNES header gives the number of sides. Anything after them is
+	// ignored.
+	sides := 0
+	if bytes.HasPrefix(raw, []byte("FDS\x1A")) {
+		if len(raw) < fdsHeaderSize {
+			return &FDS{}, errors.New("Truncated fwNES header")
+		}
+		sides = int(raw[4])
+		raw = raw[fdsHeaderSize:]
+	}
+
+	if !bytes.HasPrefix(raw, []byte("\x01*NINTENDO-HVC*")) {
+		return &FDS{}, errors.New("Not a valid FDS format")
+	}
+
+	r := &FDS{}
+	for len(raw) >= fdsSideSize && (sides == 0 || len(r.sides) < sides) {
+		r.sides = append(r.sides, raw[:fdsSideSize])
+		raw = raw[fdsSideSize:]
+	}
+
+	if len(r.sides) == 0 {
+		return r, errors.New("FDS image is shorter than one disk side")
+	}
+	if len(r.sides) < sides {
+		return r, fmt.Errorf("FDS header has %v sides but the image only holds %v", sides, len(r.sides))
+	}
+
+	return r, nil
+}
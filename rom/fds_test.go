@@ -0,0 +1,56 @@
+package rom
+
+import (
+	"bytes"
+	"testing"
+)
+
+// fwNESHeader is the fwNES header for an image of sides disk sides
+func fwNESHeader(sides int) []byte {
+	return append([]byte{'F', 'D', 'S', 0x1A, byte(sides)}, make([]byte, 11)...)
+}
+
+func TestFDSSides(t *testing.T) {
+	twoSides := append(fdsSide(), fdsSide()...)
+	twoSides[fdsSideSize+fdsSideSize/2] = 0xFF // Tell the sides apart
+
+	tests := []struct {
+		name  string
+		image []byte
+		sides int
+		ok    bool
+	}{
+		{"fwNES", append(fwNESHeader(2), twoSides...), 2, true},
+		{"fwNES with trailing data", append(fwNESHeader(1), twoSides...), 1, true},
+		{"fwNES without a count", append(fwNESHeader(0), twoSides...), 2, true},
+		{"fwNES missing a side", append(fwNESHeader(3), twoSides...), 0, false},
+		{"fwNES short a side", append(fwNESHeader(1), twoSides[:fdsSideSize-1]...), 0, false},
+		{"truncated fwNES header", []byte("FDS\x1A\x01"), 0, false},
+		{"raw", twoSides, 2, true},
+		{"raw with a partial side", twoSides[:fdsSideSize+100], 1, true},
+		{"raw short a side", twoSides[:fdsSideSize-1], 0, false},
+		{"bad disk info block", make([]byte, fdsSideSize), 0, false},
+	}
+
+	for _, test := range tests {
+		r, err := NewFDS(bytes.NewReader(test.image))
+		if test.ok != (err == nil) {
+			t.Errorf("%v: error %v", test.name, err)
+			continue
+		}
+		if !test.ok {
+			continue
+		}
+
+		sides := r.(*FDS).Sides()
+		if len(sides) != test.sides {
+			t.Errorf("%v: %v sides, want %v", test.name, len(sides), test.sides)
+			continue
+		}
+		for i, side := range sides {
+			if !bytes.Equal(side, twoSides[i*fdsSideSize:(i+1)*fdsSideSize]) {
+				t.Errorf("%v: side %v doesn't match the image", test.name, i+1)
+			}
+		}
+	}
+}
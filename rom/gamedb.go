@@ -0,0 +1,163 @@
+package rom
+
+import (
+	"bufio"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// GameInfo is what the game database knows about a dump. Games are keyed by
+// the CRC32 of their PRG-ROM followed by their CHR-ROM, and, when the entry
+// has one, confirmed by the SHA-1 of the same data.
+type GameInfo struct {
+	Name      string
+	CRC32     uint32
+	SHA1      string
+	Mapper    int
+	Submapper int
+	Mirroring Mirroring
+	Battery   bool
+	Timing    Timing
+}
+
+// gameDBData is the built in database from gamedb.csv, in the same format
+// LoadGameDB reads. Each line is:
+//
+//	crc32,sha1,mapper,submapper,mirroring,battery,region,name
+//
+// crc32 and sha1 are hex, sha1 may be empty. mirroring is H, V, A, B or 4,
+// battery is 0 or 1, and region is NTSC, PAL, Multi or Dendy.
+//
+//go:embed gamedb.csv
+var gameDBData string
+
+var gameDB = map[uint32]GameInfo{}
+
+func init() {
+	if err := LoadGameDB(strings.NewReader(gameDBData)); err != nil {
+		panic(err)
+	}
+}
+
+var dbMirroring = map[string]Mirroring{
+	"H": MirrorHorizontal,
+	"V": MirrorVertical,
+	"A": MirrorSingleA,
+	"B": MirrorSingleB,
+	"4": MirrorFourScreen,
+}
+
+var dbTiming = map[string]Timing{
+	"NTSC":  TimingNTSC,
+	"PAL":   TimingPAL,
+	"Multi": TimingMultiRegion,
+	"Dendy": TimingDendy,
+}
+
+// LoadGameDB adds the games in r to the database, replacing any already there
+// with the same CRC32. Blank lines and lines starting with # are skipped. If
+// any line is bad, nothing is added.
+func LoadGameDB(r io.Reader) error {
+	games, err := parseGameDB(r)
+	if err != nil {
+		return err
+	}
+
+	for crc, game := range games {
+		gameDB[crc] = game
+	}
+	return nil
+}
+
+func parseGameDB(r io.Reader) (map[uint32]GameInfo, error) {
+	games := map[uint32]GameInfo{}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		game, err := parseGameInfo(text)
+		if err != nil {
+			return nil, fmt.Errorf("Game database line %v: %v", line, err)
+		}
+		games[game.CRC32] = game
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return games, nil
+}
+
+func parseGameInfo(text string) (GameInfo, error) {
+	fields := strings.SplitN(text, ",", 8)
+	if len(fields) != 8 {
+		return GameInfo{}, fmt.Errorf("expected 8 fields, got %v", len(fields))
+	}
+
+	crc, err := strconv.ParseUint(fields[0], 16, 32)
+	if err != nil {
+		return GameInfo{}, fmt.Errorf("bad CRC32 %q", fields[0])
+	}
+	mapper, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return GameInfo{}, fmt.Errorf("bad mapper %q", fields[2])
+	}
+	submapper, err := strconv.Atoi(fields[3])
+	if err != nil {
+		return GameInfo{}, fmt.Errorf("bad submapper %q", fields[3])
+	}
+	mirroring, ok := dbMirroring[fields[4]]
+	if !ok {
+		return GameInfo{}, fmt.Errorf("bad mirroring %q", fields[4])
+	}
+	timing, ok := dbTiming[fields[6]]
+	if !ok {
+		return GameInfo{}, fmt.Errorf("bad region %q", fields[6])
+	}
+
+	return GameInfo{
+		Name:      fields[7],
+		CRC32:     uint32(crc),
+		SHA1:      strings.ToLower(fields[1]),
+		Mapper:    mapper,
+		Submapper: submapper,
+		Mirroring: mirroring,
+		Battery:   fields[5] == "1",
+		Timing:    timing,
+	}, nil
+}
+
+// LookupGame finds a dump in the database by the CRC32 and SHA-1 of its PRG
+// and CHR-ROM.
+func LookupGame(crc uint32, sha1 string) (GameInfo, bool) {
+	game, ok := gameDB[crc]
+	if !ok || (game.SHA1 != "" && game.SHA1 != strings.ToLower(sha1)) {
+		return GameInfo{}, false
+	}
+	return game, true
+}
+
+// Hash returns the CRC32 and SHA-1 of PRG-ROM followed by CHR-ROM, which is
+// what the game database is keyed by.
+func Hash(prg, chr []*byte) (uint32, string) {
+	crc := crc32.NewIEEE()
+	sum := sha1.New()
+	for _, rom := range [][]*byte{prg, chr} {
+		for _, b := range rom {
+			crc.Write([]byte{*b})
+			sum.Write([]byte{*b})
+		}
+	}
+	return crc.Sum32(), hex.EncodeToString(sum.Sum(nil))
+}
@@ -0,0 +1,129 @@
+package rom
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"strings"
+	"testing"
+)
+
+// badDump is an iNES 1.0 image whose header claims NROM with horizontal
+// mirroring and no battery
+func badDump() (image []byte, crc uint32, sum string) {
+	image = inesImage([16]byte{'N', 'E', 'S', 0x1A, 2, 1}, 0x4000*2+0x2000)
+	for i := headerSize; i < len(image); i++ {
+		image[i] = byte(i * 7)
+	}
+
+	data := image[headerSize:]
+	hash := sha1.Sum(data)
+	return image, crc32.ChecksumIEEE(data), hex.EncodeToString(hash[:])
+}
+
+func TestGameDBCorrectsHeader(t *testing.T) {
+	image, crc, sum := badDump()
+	entry := fmt.Sprintf("%08X,%v,2,2,V,1,PAL,Bad Dump\n", crc, strings.ToUpper(sum))
+	if err := LoadGameDB(strings.NewReader(entry)); err != nil {
+		t.Fatal(err)
+	}
+	defer delete(gameDB, crc)
+
+	loaded, err := NewINES(bytes.NewReader(image))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := loaded.(*INES)
+
+	want := []string{
+		"mapper 0 -> 2",
+		"submapper 0 -> 2",
+		"mirroring Horizontal -> Vertical",
+		"battery false -> true",
+		"region NTSC -> PAL",
+	}
+	if got := r.Corrections(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Corrections %q, want %q", got, want)
+	}
+
+	if r.Mapper() != 2 || r.Submapper() != 2 {
+		t.Errorf("Mapper %v.%v, want 2.2", r.Mapper(), r.Submapper())
+	}
+	if r.Mirroring() != MirrorVertical {
+		t.Errorf("Mirroring %v, want vertical", r.Mirroring())
+	}
+	if !r.Battery() || r.PRGNVRAMSize() != defaultRAMSize || r.PRGRAMSize() != 0 {
+		t.Errorf("Battery %v with %v bytes of PRG-NVRAM, want 8KB battery backed", r.Battery(), r.PRGNVRAMSize())
+	}
+	if r.Timing() != TimingPAL {
+		t.Errorf("Timing %v, want PAL", r.Timing())
+	}
+	if game, ok := r.Game(); !ok || game.Name != "Bad Dump" {
+		t.Errorf("Game %q (%v), want the database entry", game.Name, ok)
+	}
+}
+
+func TestGameDBNeedsMatchingSHA1(t *testing.T) {
+	image, crc, _ := badDump()
+	entry := fmt.Sprintf("%08X,%v,2,0,V,1,PAL,Bad Dump\n", crc, strings.Repeat("0", 40))
+	if err := LoadGameDB(strings.NewReader(entry)); err != nil {
+		t.Fatal(err)
+	}
+	defer delete(gameDB, crc)
+
+	r, err := NewINES(bytes.NewReader(image))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := r.(*INES).Corrections(); len(c) != 0 || r.Mapper() != 0 {
+		t.Errorf("Header corrected by an entry with a different SHA-1: %q", c)
+	}
+}
+
+func TestLoadGameDBErrors(t *testing.T) {
+	lines := []string{
+		"12345678,,0,0,H,0,NTSC",
+		"nothex,,0,0,H,0,NTSC,Name",
+		"12345678,,x,0,H,0,NTSC,Name",
+		"12345678,,0,x,H,0,NTSC,Name",
+		"12345678,,0,0,X,0,NTSC,Name",
+		"12345678,,0,0,H,0,SECAM,Name",
+	}
+
+	for _, line := range lines {
+		if err := LoadGameDB(strings.NewReader(line)); err == nil {
+			t.Errorf("%q loaded without an error", line)
+			delete(gameDB, 0x12345678)
+		}
+	}
+}
+
+func TestLoadGameDBAddsNothingOnError(t *testing.T) {
+	db := "12345678,,1,0,H,1,NTSC,Good\n" +
+		"87654321,,0,0,X,0,NTSC,Bad\n"
+	if err := LoadGameDB(strings.NewReader(db)); err == nil {
+		t.Fatalf("Database with a bad line loaded")
+	}
+	if game, ok := LookupGame(0x12345678, ""); ok {
+		t.Errorf("%q was added from a database that failed to load", game.Name)
+		delete(gameDB, 0x12345678)
+	}
+}
+
+// The built in database has to parse, or every ROM load would be missing it
+func TestBuiltInGameDB(t *testing.T) {
+	games, err := parseGameDB(strings.NewReader(gameDBData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for crc, game := range games {
+		if got, ok := gameDB[crc]; !ok || got != game {
+			t.Errorf("%v (%08X) isn't in the database", game.Name, crc)
+		}
+		if game.SHA1 != "" && len(game.SHA1) != 40 {
+			t.Errorf("%v has a %v digit SHA-1", game.Name, len(game.SHA1))
+		}
+	}
+}
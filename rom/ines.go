@@ -2,6 +2,7 @@ package rom
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 )
@@ -15,7 +16,8 @@ type INES struct {
 	instRom    []*byte
 	pRom       []*byte
 
-	pages int
+	pages     int
+	charPages int
 
 	fourScreen bool
 	hasTrainer bool
@@ -24,18 +26,75 @@ type INES struct {
 	vMirroring bool
 
 	ines2        bool
+	legacy       bool
 	playChoice10 bool
 	vsUnisystem  bool
 
-	mapper uint8
+	mapper    uint16
+	submapper uint8
+
+	prgRAMSize   int
+	prgNVRAMSize int
+	chrRAMSize   int
+	chrNVRAMSize int
+	timing       Timing
+	console      Console
+	expansion    int
+
+	crc32       uint32
+	sha1        string
+	game        *GameInfo
+	corrections []string
 }
 
 func (r *INES) Pages() int                 { return r.pages }
+func (r *INES) CharPages() int             { return r.charPages }
 func (r *INES) Trainer() []*byte           { return r.trainer }
 func (r *INES) ProgramRom() []*byte        { return r.programRom }
 func (r *INES) CharRom() []*byte           { return r.charRom }
 func (r *INES) PlayChoiceInstRom() []*byte { return r.instRom }
 func (r *INES) PlayChoicePRom() []*byte    { return r.pRom }
+func (r *INES) Mapper() int                { return int(r.mapper) }
+func (r *INES) Submapper() int             { return int(r.submapper) }
+func (r *INES) NES2() bool                 { return r.ines2 }
+func (r *INES) PRGRAMSize() int            { return r.prgRAMSize }
+func (r *INES) PRGNVRAMSize() int          { return r.prgNVRAMSize }
+func (r *INES) CHRRAMSize() int            { return r.chrRAMSize }
+func (r *INES) CHRNVRAMSize() int          { return r.chrNVRAMSize }
+func (r *INES) Timing() Timing             { return r.timing }
+func (r *INES) Console() Console           { return r.console }
+func (r *INES) ExpansionDevice() int       { return r.expansion }
+func (r *INES) CRC32() uint32              { return r.crc32 }
+func (r *INES) SHA1() string               { return r.sha1 }
+func (r *INES) Battery() bool              { return r.prgNVRAMSize > 0 }
+
+// Game returns the game database entry matching the dump, if there was one
+func (r *INES) Game() (GameInfo, bool) {
+	if r.game == nil {
+		return GameInfo{}, false
+	}
+	return *r.game, true
+}
+
+// LegacyHeader is true when bytes 7-15 of the header held junk and were
+// ignored
+func (r *INES) LegacyHeader() bool { return r.legacy }
+
+// Corrections lists the header fields the game database overrode
+func (r *INES) Corrections() []string { return r.corrections }
+
+func (r *INES) Mirroring() Mirroring {
+	switch {
+	case r.game != nil:
+		return r.game.Mirroring
+	case r.fourScreen:
+		return MirrorFourScreen
+	case r.vMirroring:
+		return MirrorVertical
+	default:
+		return MirrorHorizontal
+	}
+}
 
 const (
 	headerSize         int = 16
@@ -45,8 +104,35 @@ const (
 	playChoicesize         = 8192
 	pRomDataSize           = 16
 	pRomCounterOutSize     = 16
+	defaultRAMSize         = 8192
 )
 
+// maxROMExponent keeps the exponent form of an NES 2.0 ROM size within what
+// an int holds. Anything bigger can't be a real ROM anyway.
+const maxROMExponent = 30
+
+// romSize decodes an NES 2.0 ROM size from its LSB and MSB nibble. An MSB of
+// $F means the LSB holds an exponent and multiplier instead of a page count.
+func romSize(lsb byte, msb byte, pageSize int) (int, error) {
+	if msb == 0x0F {
+		exponent := uint(lsb >> 2)
+		if exponent > maxROMExponent {
+			return 0, fmt.Errorf("NES 2.0 ROM size 2^%v is too large", exponent)
+		}
+		multiplier := int(lsb&3)*2 + 1
+		return (1 << exponent) * multiplier, nil
+	}
+	return (int(msb)<<8 | int(lsb)) * pageSize, nil
+}
+
+// ramSize decodes an NES 2.0 RAM size, stored as a shift count of 64 bytes
+func ramSize(shift byte) int {
+	if shift == 0 {
+		return 0
+	}
+	return 64 << shift
+}
+
 func NewINES(reader io.Reader) (ROM, error) {
 	raw, err := ioutil.ReadAll(reader)
 
@@ -61,6 +147,9 @@ func NewINES(reader io.Reader) (ROM, error) {
 	}
 	r := &INES{raw: rawPointers}
 
+	if len(r.raw) < headerSize {
+		return r, errors.New("Not a valid iNES format")
+	}
 	r.header = r.raw[0:headerSize]
 
 	//$4E $45 $53 $1A (NES + EOF)
@@ -77,23 +166,48 @@ func NewINES(reader io.Reader) (ROM, error) {
 	r.vMirroring = flags6&1 != 0
 	r.hMirroring = !r.vMirroring
 
-	r.mapper = (flags7 & 0xF0) | (flags6 >> 4)
+	r.ines2 = flags7&0x0C == 0x08
+	r.legacy = !r.ines2 && (flags7&0x0C != 0 || *r.header[12] != 0 || *r.header[13] != 0 || *r.header[14] != 0 || *r.header[15] != 0)
+	if r.legacy {
+		// Old dumping tools left their name in bytes 7-15, "DiskDude!" being
+		// the best known. None of it is header data.
+		flags7 = 0
+	}
 
-	r.ines2 = flags7&(2<<2) == 2<<2
-	r.playChoice10 = flags7&(1<<1) != 0
-	r.vsUnisystem = flags7&1 != 0
-	r.pages = int(*r.header[4])
-	prSize := r.pages * programRomPageSize
+	r.mapper = uint16((flags7 & 0xF0) | (flags6 >> 4))
+
+	prSize := int(*r.header[4]) * programRomPageSize
+	crSize := int(*r.header[5]) * charRomPageSize
+
+	if r.ines2 {
+		r.parseNES2()
+		if prSize, err = romSize(*r.header[4], *r.header[9]&0x0F, programRomPageSize); err != nil {
+			return r, err
+		}
+		if crSize, err = romSize(*r.header[5], *r.header[9]>>4, charRomPageSize); err != nil {
+			return r, err
+		}
+	} else {
+		r.parseINES(crSize)
+	}
+
+	// The exponent form can describe ROMs smaller than a page, which still
+	// take up one
+	r.pages = (prSize + programRomPageSize - 1) / programRomPageSize
 	prStart := headerSize
 	if r.hasTrainer {
 		prStart += trainerSize
 	}
 	prEnd := prStart + prSize
 
-	crSize := int(*r.header[5]) * charRomPageSize
+	r.charPages = (crSize + charRomPageSize - 1) / charRomPageSize
 	crStart := prEnd
 	crEnd := crStart + crSize
 
+	if prSize < 0 || crSize < 0 || crEnd > len(r.raw) {
+		return r, errors.New("iNES file is shorter than its header says")
+	}
+
 	if r.hasTrainer {
 		trainerStart := headerSize
 		trainerEnd := trainerStart + trainerSize
@@ -106,5 +220,127 @@ func NewINES(reader io.Reader) (ROM, error) {
 	r.programRom = r.raw[prStart:prEnd]
 	r.charRom = r.raw[crStart:crEnd]
 
+	r.hash()
+	if game, ok := LookupGame(r.crc32, r.sha1); ok {
+		r.correct(game)
+	}
+
 	return r, nil
 }
+
+// hash keys the dump for the game database
+func (r *INES) hash() {
+	r.crc32, r.sha1 = Hash(r.programRom, r.charRom)
+}
+
+// correct overrides the header with what the game database says about the
+// dump, noting each field that changed.
+func (r *INES) correct(game GameInfo) {
+	note := func(field string, from, to interface{}) {
+		r.corrections = append(r.corrections, fmt.Sprintf("%v %v -> %v", field, from, to))
+	}
+
+	if int(r.mapper) != game.Mapper {
+		note("mapper", r.mapper, game.Mapper)
+		r.mapper = uint16(game.Mapper)
+	}
+	if int(r.submapper) != game.Submapper {
+		note("submapper", r.submapper, game.Submapper)
+		r.submapper = uint8(game.Submapper)
+	}
+	if r.Mirroring() != game.Mirroring {
+		note("mirroring", r.Mirroring(), game.Mirroring)
+		r.fourScreen = game.Mirroring == MirrorFourScreen
+		r.vMirroring = game.Mirroring == MirrorVertical
+		r.hMirroring = game.Mirroring == MirrorHorizontal
+	}
+	// Single screen layouts don't fit the header flags, so Mirroring goes by
+	// the database entry from here on
+	r.game = &game
+	if r.Battery() != game.Battery {
+		note("battery", r.Battery(), game.Battery)
+		r.sram = game.Battery
+		ram := r.prgRAMSize + r.prgNVRAMSize
+		if ram == 0 {
+			ram = defaultRAMSize
+		}
+		if game.Battery {
+			r.prgRAMSize, r.prgNVRAMSize = 0, ram
+		} else {
+			r.prgRAMSize, r.prgNVRAMSize = ram, 0
+		}
+	}
+	if r.timing != game.Timing {
+		note("region", r.timing, game.Timing)
+		r.timing = game.Timing
+	}
+}
+
+// parseINES fills in what an iNES 1.0 header leaves implied: 8KB of PRG-RAM,
+// battery backed if flags 6 says so, and 8KB of CHR-RAM when there's no
+// CHR-ROM.
+func (r *INES) parseINES(crSize int) {
+	if r.legacy {
+		r.prgRAMSize = defaultRAMSize
+		if r.sram {
+			r.prgRAMSize, r.prgNVRAMSize = 0, defaultRAMSize
+		}
+		if crSize == 0 {
+			r.chrRAMSize = defaultRAMSize
+		}
+		return
+	}
+
+	flags7 := uint8(*r.header[7])
+
+	r.playChoice10 = flags7&(1<<1) != 0
+	r.vsUnisystem = flags7&1 != 0
+	switch {
+	case r.playChoice10:
+		r.console = ConsolePlayChoice10
+	case r.vsUnisystem:
+		r.console = ConsoleVsSystem
+	}
+
+	ram := int(*r.header[8]) * defaultRAMSize
+	if ram == 0 {
+		ram = defaultRAMSize
+	}
+	if r.sram {
+		r.prgNVRAMSize = ram
+	} else {
+		r.prgRAMSize = ram
+	}
+
+	if crSize == 0 {
+		r.chrRAMSize = defaultRAMSize
+	}
+
+	if *r.header[9]&1 != 0 {
+		r.timing = TimingPAL
+	}
+}
+
+// parseNES2 reads bytes 8-15 of an NES 2.0 header
+func (r *INES) parseNES2() {
+	flags7 := uint8(*r.header[7])
+
+	r.mapper |= uint16(*r.header[8]&0x0F) << 8
+	r.submapper = uint8(*r.header[8]) >> 4
+
+	r.prgRAMSize = ramSize(*r.header[10] & 0x0F)
+	r.prgNVRAMSize = ramSize(*r.header[10] >> 4)
+	r.chrRAMSize = ramSize(*r.header[11] & 0x0F)
+	r.chrNVRAMSize = ramSize(*r.header[11] >> 4)
+
+	r.timing = Timing(*r.header[12] & 3)
+
+	r.console = Console(flags7 & 3)
+	if r.console == ConsoleExtended {
+		r.console = Console(*r.header[13] & 0x0F)
+	}
+	r.vsUnisystem = r.console == ConsoleVsSystem
+	r.playChoice10 = r.console == ConsolePlayChoice10
+
+	r.expansion = int(*r.header[15] & 0x3F)
+}
@@ -0,0 +1,121 @@
+package rom
+
+import (
+	"bytes"
+	"testing"
+)
+
+// inesImage is a header followed by size bytes of ROM
+func inesImage(header [16]byte, size int) []byte {
+	return append(header[:], make([]byte, size)...)
+}
+
+func TestNES2Header(t *testing.T) {
+	tests := []struct {
+		name   string
+		header [16]byte
+		size   int
+
+		mapper, submapper int
+		prgRAM, prgNVRAM  int
+		chrRAM, chrNVRAM  int
+		timing            Timing
+		console           Console
+		expansion         int
+		pages, charPages  int
+		prgSize, chrSize  int
+		mirroring         Mirroring
+	}{
+		{
+			name:   "extended mapper and RAM",
+			header: [16]byte{'N', 'E', 'S', 0x1A, 2, 1, 0x13, 0x48, 0x21, 0, 0x75, 0x07, 1, 0, 0, 0x05},
+			size:   2*0x4000 + 0x2000,
+			mapper: 0x141, submapper: 2,
+			prgRAM: 0x800, prgNVRAM: 0x2000, chrRAM: 0x2000,
+			timing: TimingPAL, console: ConsoleNES, expansion: 5,
+			pages: 2, charPages: 1, prgSize: 0x8000, chrSize: 0x2000,
+			mirroring: MirrorVertical,
+		},
+		{
+			name:     "extended console type",
+			header:   [16]byte{'N', 'E', 'S', 0x1A, 1, 0, 0x00, 0x0B, 0, 0, 0, 0x90, 3, 0x05, 0, 0},
+			size:     0x4000,
+			chrNVRAM: 0x8000,
+			timing:   TimingDendy, console: Console(5),
+			pages: 1, prgSize: 0x4000,
+			mirroring: MirrorHorizontal,
+		},
+		{
+			name:   "exponent size under a page",
+			header: [16]byte{'N', 'E', 'S', 0x1A, 13 << 2, 0, 0x08, 0x08, 0, 0x0F, 0, 0x07, 0, 0, 0, 0},
+			size:   0x2000,
+			chrRAM: 0x2000,
+			pages:  1, prgSize: 0x2000,
+			mirroring: MirrorFourScreen,
+		},
+		{
+			name:   "exponent size with multiplier",
+			header: [16]byte{'N', 'E', 'S', 0x1A, 10<<2 | 1, 1, 0, 0x08, 0, 0x0F, 0, 0, 0, 0, 0, 0},
+			size:   0xC00 + 0x2000,
+			pages:  1, charPages: 1, prgSize: 0xC00, chrSize: 0x2000,
+		},
+		{
+			name:   "size MSB",
+			header: [16]byte{'N', 'E', 'S', 0x1A, 1, 0, 0, 0x08, 0, 0x10, 0, 0, 0, 0, 0, 0},
+			size:   0x4000 + 0x100*0x2000,
+			pages:  1, charPages: 0x100, prgSize: 0x4000, chrSize: 0x100 * 0x2000,
+		},
+	}
+
+	for _, test := range tests {
+		r, err := NewINES(bytes.NewReader(inesImage(test.header, test.size)))
+		if err != nil {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+
+		check := func(field string, got, want interface{}) {
+			if got != want {
+				t.Errorf("%v: %v is %v, want %v", test.name, field, got, want)
+			}
+		}
+		check("NES 2.0", r.NES2(), true)
+		check("mapper", r.Mapper(), test.mapper)
+		check("submapper", r.Submapper(), test.submapper)
+		check("PRG-RAM", r.PRGRAMSize(), test.prgRAM)
+		check("PRG-NVRAM", r.PRGNVRAMSize(), test.prgNVRAM)
+		check("CHR-RAM", r.CHRRAMSize(), test.chrRAM)
+		check("CHR-NVRAM", r.CHRNVRAMSize(), test.chrNVRAM)
+		check("timing", r.Timing(), test.timing)
+		check("console", r.Console(), test.console)
+		check("expansion", r.ExpansionDevice(), test.expansion)
+		check("PRG pages", r.Pages(), test.pages)
+		check("CHR pages", r.CharPages(), test.charPages)
+		check("PRG size", len(r.ProgramRom()), test.prgSize)
+		check("CHR size", len(r.CharRom()), test.chrSize)
+		check("mirroring", r.Mirroring(), test.mirroring)
+	}
+}
+
+func TestMalformedINES(t *testing.T) {
+	tests := []struct {
+		name  string
+		image []byte
+	}{
+		{"short header", []byte{'N', 'E', 'S', 0x1A, 1, 0, 0, 0}},
+		{"bad magic", inesImage([16]byte{'N', 'E', 'Z', 0x1A, 1}, 0x4000)},
+		{"truncated PRG", inesImage([16]byte{'N', 'E', 'S', 0x1A, 2}, 0x4000)},
+		{"truncated CHR", inesImage([16]byte{'N', 'E', 'S', 0x1A, 1, 1}, 0x4000)},
+		{"missing trainer", inesImage([16]byte{'N', 'E', 'S', 0x1A, 1, 0, 0x04}, 0x4000)},
+		{"exponent overflow", inesImage([16]byte{'N', 'E', 'S', 0x1A, 0xFC, 0, 0, 0x08, 0, 0x0F}, 0x4000)},
+		{"CHR exponent overflow", inesImage([16]byte{'N', 'E', 'S', 0x1A, 1, 0xFF, 0, 0x08, 0, 0xF0}, 0x4000)},
+		{"exponent past the end", inesImage([16]byte{'N', 'E', 'S', 0x1A, 20 << 2, 0, 0, 0x08, 0, 0x0F}, 0x4000)},
+		{"size MSB past the end", inesImage([16]byte{'N', 'E', 'S', 0x1A, 1, 0, 0, 0x08, 0, 0x0E}, 0x4000)},
+	}
+
+	for _, test := range tests {
+		if _, err := NewINES(bytes.NewReader(test.image)); err == nil {
+			t.Errorf("%v: loaded without an error", test.name)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package rom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+const (
+	nsfHeaderSize = 0x80
+	nsfBankSize   = 0x1000
+
+	// Play rates, in microseconds, for files that leave them out
+	nsfNTSCSpeed = 16639
+	nsfPALSpeed  = 19997
+)
+
+// NSFMapper is the mapper number given to NSF files. They aren't cartridges,
+// so it's one iNES will never use.
+const NSFMapper = -1
+
+// NSF is a music rip in NSF or NSFe format. It holds the game's sound driver
+// and music data, plus the addresses of the routines that start a track and
+// play one frame of it.
+type NSF struct {
+	title     string
+	artist    string
+	copyright string
+
+	songs     int
+	startSong int
+
+	load uint16
+	init uint16
+	play uint16
+
+	ntscSpeed uint16
+	palSpeed  uint16
+	region    byte
+	chips     byte
+
+	banks        [8]byte
+	bankswitched bool
+	programRom   []*byte
+}
+
+func (r *NSF) Trainer() []*byte           { return []*byte{} }
+func (r *NSF) Pages() int                 { return len(r.programRom) / programRomPageSize }
+func (r *NSF) CharPages() int             { return 0 }
+func (r *NSF) ProgramRom() []*byte        { return r.programRom }
+func (r *NSF) CharRom() []*byte           { return []*byte{} }
+func (r *NSF) PlayChoiceInstRom() []*byte { return []*byte{} }
+func (r *NSF) PlayChoicePRom() []*byte    { return []*byte{} }
+func (r *NSF) Mirroring() Mirroring       { return MirrorHorizontal }
+func (r *NSF) Mapper() int                { return NSFMapper }
+func (r *NSF) Submapper() int             { return 0 }
+func (r *NSF) NES2() bool                 { return false }
+func (r *NSF) PRGRAMSize() int            { return defaultRAMSize }
+func (r *NSF) PRGNVRAMSize() int          { return 0 }
+func (r *NSF) CHRRAMSize() int            { return 0 }
+func (r *NSF) CHRNVRAMSize() int          { return 0 }
+func (r *NSF) Console() Console           { return ConsoleNES }
+func (r *NSF) ExpansionDevice() int       { return 0 }
+
+func (r *NSF) Title() string       { return r.title }
+func (r *NSF) Artist() string      { return r.artist }
+func (r *NSF) Copyright() string   { return r.copyright }
+func (r *NSF) Songs() int          { return r.songs }
+func (r *NSF) InitAddress() uint16 { return r.init }
+func (r *NSF) PlayAddress() uint16 { return r.play }
+
+// ExpansionChips is the bitmask of extra sound chips the music uses
+func (r *NSF) ExpansionChips() byte { return r.chips }
+
+// StartSong is the track to play first, counting from 1
+func (r *NSF) StartSong() int { return r.startSong }
+
+// Banks returns the 4KB banks mapped at $8000-$FFFF when a track starts. For
+// files without bankswitching, ProgramRom is laid out so these are 0-7.
+func (r *NSF) Banks() [8]byte { return r.banks }
+
+// Timing is PAL only for PAL-only rips. Dual region rips play as NTSC.
+func (r *NSF) Timing() Timing {
+	if r.region&3 == 1 {
+		return TimingPAL
+	}
+	return TimingNTSC
+}
+
+// PlaySpeed is the time between calls to the play routine, in microseconds
+func (r *NSF) PlaySpeed() int {
+	if r.Timing() == TimingPAL {
+		if r.palSpeed == 0 {
+			return nsfPALSpeed
+		}
+		return int(r.palSpeed)
+	}
+
+	if r.ntscSpeed == 0 {
+		return nsfNTSCSpeed
+	}
+	return int(r.ntscSpeed)
+}
+
+func NewNSF(reader io.Reader) (ROM, error) {
+	raw, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return &NSF{}, errors.New("Unable to read NSF format from stream")
+	}
+
+	r := &NSF{}
+	var data []byte
+
+	switch {
+	case bytes.HasPrefix(raw, []byte("NESM\x1A")) && len(raw) > nsfHeaderSize:
+		data = r.parseNSF(raw)
+	case bytes.HasPrefix(raw, []byte("NSFE")):
+		data, err = r.parseNSFE(raw)
+		if err != nil {
+			return r, err
+		}
+	default:
+		return r, errors.New("Not a valid NSF format")
+	}
+
+	if r.songs == 0 {
+		return r, errors.New("NSF file has no songs")
+	}
+	if r.startSong < 1 || r.startSong > r.songs {
+		r.startSong = 1
+	}
+
+	for _, b := range r.banks {
+		if b != 0 {
+			r.bankswitched = true
+		}
+	}
+
+	// Lay the data out in 4KB banks. Bankswitched files are padded so the
+	// load address falls at the same offset in its bank; the rest are placed
+	// where they load in a 32KB image.
+	var image []byte
+	if r.bankswitched {
+		image = append(make([]byte, r.load&0x0FFF), data...)
+	} else {
+		if r.load < 0x8000 {
+			return r, fmt.Errorf("NSF load address $%04X is below $8000", r.load)
+		}
+		image = make([]byte, 0x8000)
+		copy(image[r.load-0x8000:], data)
+		r.banks = [8]byte{0, 1, 2, 3, 4, 5, 6, 7}
+	}
+	if extra := len(image) % nsfBankSize; extra != 0 {
+		image = append(image, make([]byte, nsfBankSize-extra)...)
+	}
+	r.programRom = pointers(image)
+
+	return r, nil
+}
+
+func (r *NSF) parseNSF(raw []byte) []byte {
+	header := raw[:nsfHeaderSize]
+
+	r.songs = int(header[0x06])
+	r.startSong = int(header[0x07])
+	r.load = binary.LittleEndian.Uint16(header[0x08:])
+	r.init = binary.LittleEndian.Uint16(header[0x0A:])
+	r.play = binary.LittleEndian.Uint16(header[0x0C:])
+	r.title = cString(header[0x0E:0x2E])
+	r.artist = cString(header[0x2E:0x4E])
+	r.copyright = cString(header[0x4E:0x6E])
+	r.ntscSpeed = binary.LittleEndian.Uint16(header[0x6E:])
+	copy(r.banks[:], header[0x70:0x78])
+	r.palSpeed = binary.LittleEndian.Uint16(header[0x78:])
+	r.region = header[0x7A]
+	r.chips = header[0x7B]
+
+	return raw[nsfHeaderSize:]
+}
+
+// parseNSFE reads an NSFe file, which holds the same information as an NSF
+// header but in chunks, each a length, a four letter ID and the data.
+func (r *NSF) parseNSFE(raw []byte) ([]byte, error) {
+	var data []byte
+	info := false
+
+	for chunks := raw[4:]; len(chunks) > 0; {
+		if len(chunks) < 8 {
+			return nil, errors.New("Truncated NSFe chunk header")
+		}
+
+		size := binary.LittleEndian.Uint32(chunks[0:4])
+		id := string(chunks[4:8])
+		if uint32(len(chunks)-8) < size {
+			return nil, fmt.Errorf("Truncated NSFe %v chunk", id)
+		}
+		chunk := chunks[8 : 8+size]
+		chunks = chunks[8+size:]
+
+		switch id {
+		case "INFO":
+			if len(chunk) < 8 {
+				return nil, errors.New("NSFe INFO chunk is too short")
+			}
+			info = true
+			r.load = binary.LittleEndian.Uint16(chunk[0:])
+			r.init = binary.LittleEndian.Uint16(chunk[2:])
+			r.play = binary.LittleEndian.Uint16(chunk[4:])
+			r.region = chunk[6]
+			r.chips = chunk[7]
+			r.songs = 1
+			if len(chunk) > 8 {
+				r.songs = int(chunk[8])
+			}
+			if len(chunk) > 9 {
+				r.startSong = int(chunk[9]) + 1
+			}
+		case "DATA":
+			data = chunk
+		case "BANK":
+			copy(r.banks[:], chunk)
+		case "RATE":
+			if len(chunk) >= 2 {
+				r.ntscSpeed = binary.LittleEndian.Uint16(chunk[0:])
+			}
+			if len(chunk) >= 4 {
+				r.palSpeed = binary.LittleEndian.Uint16(chunk[2:])
+			}
+		case "auth":
+			fields := strings.Split(string(chunk), "\x00")
+			for i, f := range fields {
+				switch i {
+				case 0:
+					r.title = f
+				case 1:
+					r.artist = f
+				case 2:
+					r.copyright = f
+				}
+			}
+		case "NEND":
+			chunks = nil
+		}
+	}
+
+	if !info || data == nil {
+		return nil, errors.New("NSFe file is missing its INFO or DATA chunk")
+	}
+
+	return data, nil
+}
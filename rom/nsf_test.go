@@ -0,0 +1,77 @@
+package rom
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNSFEChunks(t *testing.T) {
+	info := unifChunk{"INFO", []byte{0x00, 0x80, 0x10, 0x80, 0x20, 0x80, 0x01, 0x05, 3, 1}}
+	data := unifChunk{"DATA", []byte{0x60}}
+	end := unifChunk{"NEND", nil}
+
+	image := nsfeImage(
+		info,
+		unifChunk{"RATE", []byte{0x10, 0x27, 0x20, 0x4E}},
+		unifChunk{"auth", []byte("Title\x00Artist\x00Copyright\x00Ripper\x00")},
+		unifChunk{"tlbl", []byte("Ignored\x00")},
+		data,
+		end,
+	)
+	r, err := NewNSF(bytes.NewReader(append(image, "junk after NEND"...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nsf := r.(*NSF)
+	if nsf.Title() != "Title" || nsf.Artist() != "Artist" || nsf.Copyright() != "Copyright" {
+		t.Errorf("auth read as %q, %q, %q", nsf.Title(), nsf.Artist(), nsf.Copyright())
+	}
+	if nsf.InitAddress() != 0x8010 || nsf.PlayAddress() != 0x8020 {
+		t.Errorf("Init $%04X and play $%04X, want $8010 and $8020", nsf.InitAddress(), nsf.PlayAddress())
+	}
+	if nsf.Songs() != 3 || nsf.StartSong() != 2 {
+		t.Errorf("%v songs starting at %v, want 3 starting at 2", nsf.Songs(), nsf.StartSong())
+	}
+	if nsf.Timing() != TimingPAL || nsf.PlaySpeed() != 20000 {
+		t.Errorf("%v at %vus, want PAL at 20000us", nsf.Timing(), nsf.PlaySpeed())
+	}
+	if nsf.ExpansionChips() != 0x05 {
+		t.Errorf("Expansion chips $%02X, want $05", nsf.ExpansionChips())
+	}
+	if got := *nsf.ProgramRom()[0]; got != 0x60 {
+		t.Errorf("$8000 holds $%02X, want the DATA chunk's $60", got)
+	}
+}
+
+func TestMalformedNSFE(t *testing.T) {
+	info := unifChunk{"INFO", []byte{0x00, 0x80, 0x00, 0x80, 0x03, 0x80, 0, 0}}
+	data := unifChunk{"DATA", []byte{0x60}}
+	end := unifChunk{"NEND", nil}
+	truncated := nsfeImage(info, unifChunk{"DATA", make([]byte, 0x100)})
+
+	tests := []struct {
+		name  string
+		image []byte
+	}{
+		{"missing INFO", nsfeImage(data, end)},
+		{"missing DATA", nsfeImage(info, end)},
+		{"DATA after NEND", nsfeImage(info, end, data)},
+		{"short INFO", nsfeImage(unifChunk{"INFO", info.data[:7]}, data, end)},
+		{"no songs", nsfeImage(unifChunk{"INFO", append(info.data, 0)}, data, end)},
+		{"truncated chunk", truncated[:len(truncated)-1]},
+		{"truncated chunk header", append(nsfeImage(info, data), 1, 0, 0, 0)},
+		{"huge chunk", append(nsfeImage(info, data), 0xFF, 0xFF, 0xFF, 0xFF, 'B', 'A', 'N', 'K')},
+	}
+
+	for _, test := range tests {
+		if _, err := NewNSF(bytes.NewReader(test.image)); err == nil {
+			t.Errorf("%v: loaded", test.name)
+		}
+	}
+
+	// Without NEND the file just ends after the last chunk
+	if _, err := NewNSF(bytes.NewReader(nsfeImage(info, data))); err != nil {
+		t.Errorf("Without NEND: %v", err)
+	}
+}
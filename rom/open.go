@@ -0,0 +1,122 @@
+package rom
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// romExtensions are the files Open looks for inside a zip archive
+var romExtensions = map[string]bool{
+	".nes":  true,
+	".unf":  true,
+	".unif": true,
+	".fds":  true,
+	".nsf":  true,
+	".nsfe": true,
+}
+
+// Open loads a ROM file of any supported format, picking the loader from the
+// file's magic bytes rather than its extension. ROMs inside .zip and .gz
+// archives are unpacked on the way, and a patch found by FindPatch is
+// applied.
+func Open(path string) (ROM, error) {
+	return OpenPatched(path, FindPatch(path))
+}
+
+// OpenPatched is Open with an explicit patch file. No patch is applied if
+// patch is "".
+func OpenPatched(path string, patch string) (ROM, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = unpack(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if patch == "" {
+		return Load(data)
+	}
+
+	p, err := ioutil.ReadFile(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = ApplyPatch(data, p)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to apply patch %v: %v", patch, err)
+	}
+
+	r, err := Load(data)
+	if err != nil {
+		return nil, fmt.Errorf("ROM patched with %v isn't valid: %v", patch, err)
+	}
+
+	return r, nil
+}
+
+// Load picks the loader for a ROM image from its magic bytes
+func Load(data []byte) (ROM, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("NES\x1A")):
+		return NewINES(bytes.NewReader(data))
+	case bytes.HasPrefix(data, []byte("UNIF")):
+		return NewUNIF(bytes.NewReader(data))
+	case bytes.HasPrefix(data, []byte("FDS\x1A")), bytes.HasPrefix(data, []byte("\x01*NINTENDO-HVC*")):
+		return NewFDS(bytes.NewReader(data))
+	case bytes.HasPrefix(data, []byte("NESM\x1A")), bytes.HasPrefix(data, []byte("NSFE")):
+		return NewNSF(bytes.NewReader(data))
+	default:
+		return nil, errors.New("Unrecognized ROM format")
+	}
+}
+
+// unpack returns the ROM inside a zip or gzip archive, or data unchanged if
+// it isn't an archive.
+func unpack(data []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		return unzip(data)
+	case bytes.HasPrefix(data, []byte{0x1F, 0x8B}):
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	default:
+		return data, nil
+	}
+}
+
+// unzip returns the first ROM in a zip archive
+func unzip(data []byte) ([]byte, error) {
+	z, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range z.File {
+		if !romExtensions[strings.ToLower(filepath.Ext(f.Name))] {
+			continue
+		}
+
+		r, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	}
+
+	return nil, fmt.Errorf("No ROM found in zip archive")
+}
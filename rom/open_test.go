@@ -0,0 +1,217 @@
+package rom
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// nsfImage is an NSF with one song and data loaded at $8000
+func nsfImage(data []byte) []byte {
+	header := make([]byte, nsfHeaderSize)
+	copy(header, "NESM\x1A")
+	header[0x05] = 1
+	header[0x06] = 1
+	header[0x07] = 1
+	binary.LittleEndian.PutUint16(header[0x08:], 0x8000)
+	binary.LittleEndian.PutUint16(header[0x0A:], 0x8000)
+	binary.LittleEndian.PutUint16(header[0x0C:], 0x8003)
+	return append(header, data...)
+}
+
+// nsfeImage is an NSFe made of the given chunks
+func nsfeImage(chunks ...unifChunk) []byte {
+	image := []byte("NSFE")
+	for _, c := range chunks {
+		header := make([]byte, 8)
+		binary.LittleEndian.PutUint32(header, uint32(len(c.data)))
+		copy(header[4:], c.id)
+		image = append(image, header...)
+		image = append(image, c.data...)
+	}
+	return image
+}
+
+// nsfeInfo is an INFO chunk loading and starting at $8000
+var nsfeInfo = unifChunk{"INFO", []byte{0x00, 0x80, 0x00, 0x80, 0x03, 0x80, 0, 0, 1, 0}}
+
+// fdsSide is a disk side starting with the disk info block
+func fdsSide() []byte {
+	side := make([]byte, fdsSideSize)
+	copy(side, "\x01*NINTENDO-HVC*")
+	return side
+}
+
+// fwNESImage is sides disk sides behind the fwNES header
+func fwNESImage(sides int) []byte {
+	image := fwNESHeader(sides)
+	for i := 0; i < sides; i++ {
+		image = append(image, fdsSide()...)
+	}
+	return image
+}
+
+func zipImage(t *testing.T, files map[string][]byte, order ...string) []byte {
+	var buf bytes.Buffer
+	z := zip.NewWriter(&buf)
+	for _, name := range order {
+		w, err := z.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(files[name])
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func gzipImage(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	z := gzip.NewWriter(&buf)
+	z.Write(data)
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestLoadSniffsFormat(t *testing.T) {
+	ines := inesImage([16]byte{'N', 'E', 'S', 0x1A, 1, 1}, 0x4000+0x2000)
+	unif := unifImage(
+		unifChunk{"MAPR", []byte("NES-NROM-128\x00")},
+		unifChunk{"PRG0", make([]byte, 0x4000)},
+		unifChunk{"CHR0", make([]byte, 0x2000)},
+	)
+
+	tests := []struct {
+		name   string
+		image  []byte
+		mapper int
+	}{
+		{"iNES", ines, 0},
+		{"UNIF", unif, 0},
+		{"NSF", nsfImage([]byte{0x60}), NSFMapper},
+		{"NSFe", nsfeImage(nsfeInfo, unifChunk{"DATA", []byte{0x60}}, unifChunk{"NEND", nil}), NSFMapper},
+		{"fwNES", fwNESImage(1), FDSMapper},
+		{"raw FDS", fdsSide(), FDSMapper},
+	}
+
+	for _, test := range tests {
+		r, err := Load(test.image)
+		if err != nil {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+		if r.Mapper() != test.mapper {
+			t.Errorf("%v: loaded as mapper %v, want %v", test.name, r.Mapper(), test.mapper)
+		}
+	}
+}
+
+func TestLoadUnknownMagic(t *testing.T) {
+	for _, image := range [][]byte{
+		nil,
+		[]byte("NES"),
+		[]byte("NES\x00rest of a header"),
+		append([]byte("PK\x05\x06"), make([]byte, 0x4010)...),
+	} {
+		if r, err := Load(image); err == nil {
+			t.Errorf("Loaded %q as %T", image, r)
+		}
+	}
+}
+
+func TestUnpack(t *testing.T) {
+	ines := inesImage([16]byte{'N', 'E', 'S', 0x1A, 1, 1}, 0x4000+0x2000)
+	corrupt := gzipImage(t, ines)
+	corrupt = corrupt[:len(corrupt)/2]
+
+	tests := []struct {
+		name  string
+		image []byte
+		want  []byte
+		ok    bool
+	}{
+		{"plain", ines, ines, true},
+		{"gzip", gzipImage(t, ines), ines, true},
+		{
+			name: "zip with several entries",
+			image: zipImage(t, map[string][]byte{
+				"readme.txt":     []byte("NES\x1Anot a ROM"),
+				"Game (U).NES":   ines,
+				"Game (E).nes":   []byte("second ROM"),
+				"screenshot.png": nil,
+			}, "readme.txt", "Game (U).NES", "Game (E).nes", "screenshot.png"),
+			want: ines,
+			ok:   true,
+		},
+		{
+			name:  "zip with no ROM",
+			image: zipImage(t, map[string][]byte{"readme.txt": ines}, "readme.txt"),
+		},
+		{"corrupt gzip", corrupt, nil, false},
+		{"corrupt zip", []byte("PK\x03\x04 but nothing else"), nil, false},
+	}
+
+	for _, test := range tests {
+		data, err := unpack(test.image)
+		if test.ok != (err == nil) {
+			t.Errorf("%v: error %v", test.name, err)
+			continue
+		}
+		if test.ok && !bytes.Equal(data, test.want) {
+			t.Errorf("%v: unpacked %v bytes, want the %v byte ROM", test.name, len(data), len(test.want))
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nesgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ines := inesImage([16]byte{'N', 'E', 'S', 0x1A, 1, 1}, 0x4000+0x2000)
+	files := map[string][]byte{
+		"game.zip": zipImage(t, map[string][]byte{"game.nes": ines}, "game.nes"),
+		"game.gz":  gzipImage(t, fwNESImage(2)),
+		"game.bin": nsfImage([]byte{0x60}),
+		"game.txt": []byte("not a ROM"),
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		mapper int
+		ok     bool
+	}{
+		{"game.zip", 0, true},
+		{"game.gz", FDSMapper, true},
+		{"game.bin", NSFMapper, true},
+		{"game.txt", 0, false},
+		{"missing.nes", 0, false},
+	}
+
+	for _, test := range tests {
+		r, err := Open(filepath.Join(dir, test.name))
+		if test.ok != (err == nil) {
+			t.Errorf("%v: error %v", test.name, err)
+			continue
+		}
+		if test.ok && r.Mapper() != test.mapper {
+			t.Errorf("%v: loaded as mapper %v, want %v", test.name, r.Mapper(), test.mapper)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package rom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// patchExtensions are the patch formats FindPatch looks for, in order
+var patchExtensions = []string{".ips", ".ups", ".bps"}
+
+// patchMaxSize bounds every size and offset in a UPS or BPS patch. It's far
+// bigger than any NES ROM, and small enough that a corrupt patch can't ask
+// for more memory than we have.
+const patchMaxSize = 64 << 20
+
+// FindPatch returns the patch next to a ROM, either game.nes.ips or
+// game.ips, or "" if there isn't one.
+func FindPatch(path string) string {
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	for _, ext := range patchExtensions {
+		for _, p := range []string{path + ext, base + ext} {
+			if _, err := os.Stat(p); err == nil {
+				return p
+			}
+		}
+	}
+	return ""
+}
+
+// ApplyPatch patches a ROM image with an IPS, UPS or BPS patch, picked by the
+// patch's magic bytes. UPS and BPS patches carry CRCs of the image before and
+// after, and both are checked.
+func ApplyPatch(data []byte, patch []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(patch, []byte("PATCH")):
+		return applyIPS(data, patch)
+	case bytes.HasPrefix(patch, []byte("UPS1")):
+		return applyUPS(data, patch)
+	case bytes.HasPrefix(patch, []byte("BPS1")):
+		return applyBPS(data, patch)
+	default:
+		return nil, errors.New("Not an IPS, UPS or BPS patch")
+	}
+}
+
+// applyIPS applies records of an offset, a size and the bytes to write there.
+// A zero size is a run of a single byte. An optional truncation size follows
+// the EOF marker.
+func applyIPS(data []byte, patch []byte) ([]byte, error) {
+	out := append([]byte{}, data...)
+	p := patch[5:]
+
+	for {
+		if len(p) < 3 {
+			return nil, errors.New("IPS patch is missing its EOF marker")
+		}
+		if string(p[:3]) == "EOF" {
+			p = p[3:]
+			break
+		}
+		if len(p) < 5 {
+			return nil, errors.New("Truncated IPS record")
+		}
+
+		offset := int(p[0])<<16 | int(p[1])<<8 | int(p[2])
+		size := int(p[3])<<8 | int(p[4])
+		p = p[5:]
+
+		var chunk []byte
+		if size == 0 {
+			if len(p) < 3 {
+				return nil, errors.New("Truncated IPS run record")
+			}
+			size = int(p[0])<<8 | int(p[1])
+			chunk = bytes.Repeat(p[2:3], size)
+			p = p[3:]
+		} else {
+			if len(p) < size {
+				return nil, errors.New("Truncated IPS record")
+			}
+			chunk = p[:size]
+			p = p[size:]
+		}
+
+		if end := offset + len(chunk); end > len(out) {
+			out = append(out, make([]byte, end-len(out))...)
+		}
+		copy(out[offset:], chunk)
+	}
+
+	if len(p) >= 3 {
+		if size := int(p[0])<<16 | int(p[1])<<8 | int(p[2]); size < len(out) {
+			out = out[:size]
+		}
+	}
+
+	return out, nil
+}
+
+// patchReader reads the variable length numbers UPS and BPS use
+type patchReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *patchReader) byte() byte {
+	if r.pos >= len(r.data) {
+		r.err = errors.New("Patch ends unexpectedly")
+		return 0
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b
+}
+
+// number reads a number, failing rather than overflowing on ones bigger than
+// patchMaxSize
+func (r *patchReader) number() int {
+	n, shift := 0, 1
+	for r.err == nil {
+		b := r.byte()
+		n += int(b&0x7F) * shift
+		if b&0x80 != 0 {
+			break
+		}
+		shift <<= 7
+		n += shift
+		if shift > patchMaxSize {
+			r.err = errors.New("Patch has a number that's too big")
+		}
+	}
+	if r.err == nil && n > patchMaxSize {
+		r.err = errors.New("Patch has a number that's too big")
+	}
+	return n
+}
+
+// skip moves past n bytes of the patch
+func (r *patchReader) skip(n int) {
+	if n > len(r.data)-r.pos {
+		r.err = errors.New("Patch ends unexpectedly")
+		return
+	}
+	r.pos += n
+}
+
+// patchCRCs checks the source, target and patch CRCs in the last 12 bytes of
+// a UPS or BPS patch.
+func patchCRCs(format string, patch []byte) (source, target uint32, err error) {
+	if len(patch) < 12 {
+		return 0, 0, fmt.Errorf("%v patch is too short", format)
+	}
+
+	footer := patch[len(patch)-12:]
+	if crc32.ChecksumIEEE(patch[:len(patch)-4]) != binary.LittleEndian.Uint32(footer[8:]) {
+		return 0, 0, fmt.Errorf("%v patch is corrupt, its CRC doesn't match", format)
+	}
+
+	return binary.LittleEndian.Uint32(footer[0:]), binary.LittleEndian.Uint32(footer[4:]), nil
+}
+
+// applyUPS XORs the patch into the image. Each hunk skips some bytes, then
+// XORs bytes up to and including a zero byte.
+func applyUPS(data []byte, patch []byte) ([]byte, error) {
+	sourceCRC, targetCRC, err := patchCRCs("UPS", patch)
+	if err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(data) != sourceCRC {
+		return nil, errors.New("UPS patch is for a different ROM, the source CRC doesn't match")
+	}
+
+	r := &patchReader{data: patch[:len(patch)-12], pos: 4}
+	sourceSize := r.number()
+	targetSize := r.number()
+	if r.err != nil {
+		return nil, r.err
+	}
+	if sourceSize != len(data) {
+		return nil, fmt.Errorf("UPS patch is for a %v byte ROM, not %v bytes", sourceSize, len(data))
+	}
+
+	out := make([]byte, targetSize)
+	copy(out, data)
+
+	offset := 0
+	for r.err == nil && r.pos < len(r.data) {
+		offset += r.number()
+		for r.err == nil {
+			x := r.byte()
+			if offset < len(out) {
+				out[offset] ^= x
+			}
+			offset++
+			if x == 0 {
+				break
+			}
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	if crc32.ChecksumIEEE(out) != targetCRC {
+		return nil, errors.New("UPS patch produced the wrong ROM, the target CRC doesn't match")
+	}
+
+	return out, nil
+}
+
+// BPS actions
+const (
+	bpsSourceRead = iota
+	bpsTargetRead
+	bpsSourceCopy
+	bpsTargetCopy
+)
+
+// applyBPS builds the patched image from copies out of the source, the patch
+// and the image being built.
+func applyBPS(data []byte, patch []byte) ([]byte, error) {
+	sourceCRC, targetCRC, err := patchCRCs("BPS", patch)
+	if err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(data) != sourceCRC {
+		return nil, errors.New("BPS patch is for a different ROM, the source CRC doesn't match")
+	}
+
+	r := &patchReader{data: patch[:len(patch)-12], pos: 4}
+	sourceSize := r.number()
+	targetSize := r.number()
+	r.skip(r.number()) // Metadata
+	if r.err != nil {
+		return nil, r.err
+	}
+	if sourceSize != len(data) {
+		return nil, fmt.Errorf("BPS patch is for a %v byte ROM, not %v bytes", sourceSize, len(data))
+	}
+
+	out := make([]byte, 0, targetSize)
+	sourceOffset, targetOffset := 0, 0
+	outOfRange := errors.New("BPS patch reads outside the ROM")
+
+	signed := func() int {
+		n := r.number()
+		if n&1 != 0 {
+			return -(n >> 1)
+		}
+		return n >> 1
+	}
+
+	for r.err == nil && r.pos < len(r.data) {
+		action := r.number()
+		length := action>>2 + 1
+		if r.err != nil {
+			break
+		}
+		if len(out)+length > targetSize {
+			return nil, errors.New("BPS patch writes past the end of the ROM")
+		}
+
+		switch action & 3 {
+		case bpsSourceRead:
+			start := len(out)
+			if start+length > len(data) {
+				return nil, outOfRange
+			}
+			out = append(out, data[start:start+length]...)
+		case bpsTargetRead:
+			if r.pos+length > len(r.data) {
+				return nil, outOfRange
+			}
+			out = append(out, r.data[r.pos:r.pos+length]...)
+			r.pos += length
+		case bpsSourceCopy:
+			sourceOffset += signed()
+			if sourceOffset < 0 || sourceOffset+length > len(data) {
+				return nil, outOfRange
+			}
+			out = append(out, data[sourceOffset:sourceOffset+length]...)
+			sourceOffset += length
+		case bpsTargetCopy:
+			targetOffset += signed()
+			if targetOffset < 0 || targetOffset >= len(out) {
+				return nil, outOfRange
+			}
+			// Byte at a time, the copy can overlap what it's writing
+			for i := 0; i < length; i++ {
+				out = append(out, out[targetOffset])
+				targetOffset++
+			}
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	if len(out) != targetSize || crc32.ChecksumIEEE(out) != targetCRC {
+		return nil, errors.New("BPS patch produced the wrong ROM, the target CRC doesn't match")
+	}
+
+	return out, nil
+}
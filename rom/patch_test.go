@@ -0,0 +1,258 @@
+package rom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+)
+
+// patchNumber encodes n the way UPS and BPS do
+func patchNumber(n int) []byte {
+	var b []byte
+	for {
+		x := byte(n & 0x7F)
+		n >>= 7
+		if n == 0 {
+			return append(b, 0x80|x)
+		}
+		b = append(b, x)
+		n--
+	}
+}
+
+// sealPatch adds the source, target and patch CRCs to a UPS or BPS patch
+func sealPatch(patch []byte, sourceCRC, targetCRC uint32) []byte {
+	footer := make([]byte, 8)
+	binary.LittleEndian.PutUint32(footer, sourceCRC)
+	binary.LittleEndian.PutUint32(footer[4:], targetCRC)
+	patch = append(append([]byte{}, patch...), footer...)
+
+	crc := make([]byte, 4)
+	binary.LittleEndian.PutUint32(crc, crc32.ChecksumIEEE(patch))
+	return append(patch, crc...)
+}
+
+// upsPatch diffs source and target
+func upsPatch(source, target []byte) []byte {
+	xor := func(i int) byte {
+		if i < len(source) {
+			return source[i] ^ target[i]
+		}
+		return target[i]
+	}
+
+	p := append([]byte("UPS1"), patchNumber(len(source))...)
+	p = append(p, patchNumber(len(target))...)
+	last := 0
+	for i := 0; i < len(target); i++ {
+		if xor(i) == 0 {
+			continue
+		}
+		p = append(p, patchNumber(i-last)...)
+		for ; i < len(target) && xor(i) != 0; i++ {
+			p = append(p, xor(i))
+		}
+		p = append(p, 0)
+		last = i + 1
+	}
+
+	return sealPatch(p, crc32.ChecksumIEEE(source), crc32.ChecksumIEEE(target))
+}
+
+// bpsHeader starts a BPS patch with metadata
+func bpsHeader(sourceSize, targetSize int, metadata string) []byte {
+	p := append([]byte("BPS1"), patchNumber(sourceSize)...)
+	p = append(p, patchNumber(targetSize)...)
+	p = append(p, patchNumber(len(metadata))...)
+	return append(p, metadata...)
+}
+
+// bpsAction encodes an action, and the relative offset copies take
+func bpsAction(action, length, offset int) []byte {
+	b := patchNumber((length-1)<<2 | action)
+	switch {
+	case action < bpsSourceCopy:
+	case offset < 0:
+		b = append(b, patchNumber(-offset<<1|1)...)
+	default:
+		b = append(b, patchNumber(offset<<1)...)
+	}
+	return b
+}
+
+func testSource() []byte {
+	source := make([]byte, 16)
+	for i := range source {
+		source[i] = byte(0x10 + i)
+	}
+	return source
+}
+
+func TestIPS(t *testing.T) {
+	source := testSource()
+	tests := []struct {
+		name  string
+		patch string
+		want  []byte
+	}{
+		{
+			name:  "records",
+			patch: "PATCH\x00\x00\x02\x00\x02\xAA\xBB\x00\x00\x0E\x00\x04\x01\x02\x03\x04EOF",
+			want:  []byte{0x10, 0x11, 0xAA, 0xBB, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1A, 0x1B, 0x1C, 0x1D, 1, 2, 3, 4},
+		},
+		{
+			name:  "RLE",
+			patch: "PATCH\x00\x00\x04\x00\x00\x00\x03\xEEEOF",
+			want:  []byte{0x10, 0x11, 0x12, 0x13, 0xEE, 0xEE, 0xEE, 0x17, 0x18, 0x19, 0x1A, 0x1B, 0x1C, 0x1D, 0x1E, 0x1F},
+		},
+		{
+			name:  "truncation",
+			patch: "PATCH\x00\x00\x00\x00\x01\xFFEOF\x00\x00\x04",
+			want:  []byte{0xFF, 0x11, 0x12, 0x13},
+		},
+		{
+			name:  "truncation past the end",
+			patch: "PATCHEOF\x00\x01\x00",
+			want:  source,
+		},
+	}
+
+	for _, test := range tests {
+		got, err := ApplyPatch(source, []byte(test.patch))
+		if err != nil {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+		if !bytes.Equal(got, test.want) {
+			t.Errorf("%v: patched to % X, want % X", test.name, got, test.want)
+		}
+	}
+
+	if !bytes.Equal(source, testSource()) {
+		t.Errorf("Patching changed the original ROM")
+	}
+}
+
+func TestUPS(t *testing.T) {
+	source := testSource()
+	for _, target := range [][]byte{
+		append(append([]byte{}, source[:4]...), 0, 0, 0xAB, 0x17, 0x18, 0x19, 0, 0, 0, 0, 0, 0),
+		append(append([]byte{}, source...), 0xC0, 0x00, 0xC1),
+		source[:10],
+	} {
+		got, err := ApplyPatch(source, upsPatch(source, target))
+		if err != nil {
+			t.Errorf("Patching to % X: %v", target, err)
+			continue
+		}
+		if !bytes.Equal(got, target) {
+			t.Errorf("Patched to % X, want % X", got, target)
+		}
+	}
+}
+
+func TestBPS(t *testing.T) {
+	source := testSource()
+	want := append(append([]byte{}, source[:4]...), "abcabcabc"...)
+	want = append(want, source[8:12]...)
+
+	p := bpsHeader(len(source), len(want), "<metadata/>")
+	p = append(p, bpsAction(bpsSourceRead, 4, 0)...)
+	p = append(p, bpsAction(bpsTargetRead, 3, 0)...)
+	p = append(p, "abc"...)
+	p = append(p, bpsAction(bpsTargetCopy, 6, 4)...) // Overlaps itself
+	p = append(p, bpsAction(bpsSourceCopy, 4, 8)...)
+	p = sealPatch(p, crc32.ChecksumIEEE(source), crc32.ChecksumIEEE(want))
+
+	got, err := ApplyPatch(source, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("Patched to % X, want % X", got, want)
+	}
+}
+
+func TestPatchCRCs(t *testing.T) {
+	source := testSource()
+	target := append(append([]byte{}, source...), 1, 2, 3)
+	ups := upsPatch(source, target)
+	body := ups[:len(ups)-12]
+
+	other := testSource()
+	other[0] = 0
+
+	corrupt := append([]byte{}, ups...)
+	corrupt[6] ^= 0xFF
+
+	bps := append(bpsHeader(len(source), len(source), ""), bpsAction(bpsSourceRead, len(source), 0)...)
+	badBPS := sealPatch(bps, crc32.ChecksumIEEE(source), crc32.ChecksumIEEE(source))
+	badBPS[len(badBPS)-1] ^= 0xFF
+
+	tests := []struct {
+		name  string
+		rom   []byte
+		patch []byte
+	}{
+		{"UPS for a different ROM", other, ups},
+		{"UPS with the wrong target CRC", source, sealPatch(body, crc32.ChecksumIEEE(source), 0)},
+		{"UPS with the wrong patch CRC", source, corrupt},
+		{"BPS for a different ROM", other, sealPatch(bps, crc32.ChecksumIEEE(source), crc32.ChecksumIEEE(source))},
+		{"BPS with the wrong target CRC", source, sealPatch(bps, crc32.ChecksumIEEE(source), 0)},
+		{"BPS with the wrong patch CRC", source, badBPS},
+	}
+
+	for _, test := range tests {
+		if _, err := ApplyPatch(test.rom, test.patch); err == nil {
+			t.Errorf("%v: patched", test.name)
+		}
+	}
+
+	// The BPS patch itself is good
+	if _, err := ApplyPatch(source, sealPatch(bps, crc32.ChecksumIEEE(source), crc32.ChecksumIEEE(source))); err != nil {
+		t.Errorf("Copying the whole ROM: %v", err)
+	}
+}
+
+func TestMalformedPatches(t *testing.T) {
+	source := testSource()
+	crc := crc32.ChecksumIEEE(source)
+	ups := upsPatch(source, append(append([]byte{}, source...), 1, 2, 3))
+	ups = ups[:len(ups)-12]
+
+	// A number that never ends, and one that fits in 64 bits but is huge
+	endless := bytes.Repeat([]byte{0x7F}, 20)
+	huge := append(bytes.Repeat([]byte{0x7F}, 8), 0x80)
+
+	tests := []struct {
+		name  string
+		patch []byte
+	}{
+		{"unknown format", []byte("PPF30")},
+		{"IPS without EOF", []byte("PATCH\x00\x00\x00\x00\x01\xFF")},
+		{"truncated IPS record", []byte("PATCH\x00\x00\x00\x00\x04\xFFEOF")},
+		{"truncated IPS RLE record", []byte("PATCH\x00\x00\x00\x00\x00\x00EOF")},
+		{"truncated IPS header", []byte("PATCH\x00\x00")},
+		{"short UPS", []byte("UPS1\x80\x80")},
+		{"truncated UPS", sealPatch(ups[:len(ups)-2], crc, 0)},
+		{"UPS for a bigger ROM", sealPatch(append([]byte("UPS1"), patchNumber(len(source)+1)...), crc, 0)},
+		{"UPS with an endless number", sealPatch(append(append([]byte("UPS1"), patchNumber(len(source))...), endless...), crc, 0)},
+		{"UPS with a huge target", sealPatch(append(append([]byte("UPS1"), patchNumber(len(source))...), huge...), crc, 0)},
+		{"BPS with huge metadata", sealPatch(append(bpsHeader(len(source), 1, "")[:6], huge...), crc, 0)},
+		{"BPS with metadata past the end", sealPatch(append(bpsHeader(len(source), 1, "")[:6], patchNumber(100)...), crc, 0)},
+		{"BPS with a huge target", sealPatch(append(append(append([]byte("BPS1"), patchNumber(len(source))...), huge...), 0x80), crc, 0)},
+		{"BPS writing past the target", sealPatch(append(bpsHeader(len(source), 2, ""), bpsAction(bpsSourceRead, 4, 0)...), crc, 0)},
+		{"BPS reading past the source", sealPatch(append(bpsHeader(len(source), 32, ""), bpsAction(bpsSourceCopy, 4, 14)...), crc, 0)},
+		{"BPS reading before the source", sealPatch(append(bpsHeader(len(source), 32, ""), bpsAction(bpsSourceCopy, 4, -1)...), crc, 0)},
+		{"BPS copying unwritten target", sealPatch(append(bpsHeader(len(source), 32, ""), bpsAction(bpsTargetCopy, 4, 0)...), crc, 0)},
+		{"BPS reading past the patch", sealPatch(append(bpsHeader(len(source), 32, ""), bpsAction(bpsTargetRead, 4, 0)...), crc, 0)},
+		{"BPS with an endless action", sealPatch(append(bpsHeader(len(source), 32, ""), endless...), crc, 0)},
+	}
+
+	for _, test := range tests {
+		if _, err := ApplyPatch(source, test.patch); err == nil {
+			t.Errorf("%v: patched", test.name)
+		}
+	}
+}
@@ -1,10 +1,104 @@
 package rom
 
+import "fmt"
+
+// Mirroring is the nametable layout of a cartridge.
+type Mirroring int
+
+const (
+	MirrorHorizontal Mirroring = iota
+	MirrorVertical
+	MirrorSingleA
+	MirrorSingleB
+	MirrorFourScreen
+)
+
+func (m Mirroring) String() string {
+	switch m {
+	case MirrorHorizontal:
+		return "Horizontal"
+	case MirrorVertical:
+		return "Vertical"
+	case MirrorSingleA:
+		return "Single Screen A"
+	case MirrorSingleB:
+		return "Single Screen B"
+	case MirrorFourScreen:
+		return "Four Screen"
+	default:
+		return "Unknown"
+	}
+}
+
+// Timing is the CPU/PPU timing a cartridge was made for.
+type Timing int
+
+const (
+	TimingNTSC Timing = iota
+	TimingPAL
+	TimingMultiRegion
+	TimingDendy
+)
+
+func (t Timing) String() string {
+	switch t {
+	case TimingNTSC:
+		return "NTSC"
+	case TimingPAL:
+		return "PAL"
+	case TimingMultiRegion:
+		return "Multi-region"
+	case TimingDendy:
+		return "Dendy"
+	default:
+		return "Unknown"
+	}
+}
+
+// Console is the system a cartridge runs on. Values above ConsoleExtended
+// come from the NES 2.0 extended console type.
+type Console int
+
+const (
+	ConsoleNES Console = iota
+	ConsoleVsSystem
+	ConsolePlayChoice10
+	ConsoleExtended
+)
+
+func (c Console) String() string {
+	switch c {
+	case ConsoleNES:
+		return "NES/Famicom"
+	case ConsoleVsSystem:
+		return "Vs. System"
+	case ConsolePlayChoice10:
+		return "PlayChoice-10"
+	default:
+		return fmt.Sprintf("Extended console type %v", int(c))
+	}
+}
+
 type ROM interface {
 	Trainer() []*byte
 	Pages() int
+	CharPages() int
 	ProgramRom() []*byte
 	CharRom() []*byte
 	PlayChoiceInstRom() []*byte
 	PlayChoicePRom() []*byte
+	Mirroring() Mirroring
+	Mapper() int
+	Submapper() int
+
+	// NES2 is true when the header is in NES 2.0 format. Without it, the
+	// sizes below are the defaults iNES implies.
+	NES2() bool
+	PRGRAMSize() int
+	PRGNVRAMSize() int
+	CHRRAMSize() int
+	CHRNVRAMSize() int
+	Timing() Timing
+	Console() Console
+	ExpansionDevice() int
 }
@@ -0,0 +1,237 @@
+package rom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+const unifHeaderSize = 32
+
+// unifBoards maps UNIF board names, without their NES-/HVC-/UNL- style
+// prefix, to the iNES mapper that implements them.
+var unifBoards = map[string]int{
+	"NROM": 0, "NROM-128": 0, "NROM-256": 0, "RROM": 0, "RROM-128": 0,
+
+	"SAROM": 1, "SBROM": 1, "SCROM": 1, "SC1ROM": 1, "SEROM": 1, "SFROM": 1,
+	"SGROM": 1, "SHROM": 1, "SJROM": 1, "SKROM": 1, "SLROM": 1, "SL1ROM": 1,
+	"SL2ROM": 1, "SL3ROM": 1, "SLRROM": 1, "SNROM": 1, "SOROM": 1, "SUROM": 1,
+	"SXROM": 1,
+
+	"UNROM": 2, "UOROM": 2,
+
+	"CNROM": 3,
+
+	"TBROM": 4, "TEROM": 4, "TFROM": 4, "TGROM": 4, "TKROM": 4, "TLROM": 4,
+	"TL1ROM": 4, "TL2ROM": 4, "TNROM": 4, "TR1ROM": 4, "TSROM": 4, "TVROM": 4,
+	"B4": 4,
+
+	"EKROM": 5, "ELROM": 5, "ETROM": 5, "EWROM": 5,
+
+	"AMROM": 7, "ANROM": 7, "AN1ROM": 7, "AOROM": 7,
+
+	"PEEOROM": 9, "PNROM": 9,
+
+	"FJROM": 10, "FKROM": 10,
+
+	"COLORDREAMS": 11,
+
+	"163": 19,
+
+	"VRC4A": 21, "VRC4C": 21,
+	"VRC2A": 22,
+	"VRC2B": 23, "VRC4E": 23, "VRC4F": 23,
+	"VRC6A": 24, "VRC6": 24,
+	"VRC2C": 25, "VRC4B": 25, "VRC4D": 25,
+	"VRC6B": 26,
+
+	"GNROM": 66, "MHROM": 66,
+
+	"BTR": 69, "JLROM": 69, "JSROM": 69, "FME-7": 69,
+
+	"VRC7": 85, "VRC7A": 85, "VRC7B": 85,
+}
+
+// unifSubmappers picks out the Konami boards that share a mapper number but
+// wire the register address lines differently
+var unifSubmappers = map[string]int{
+	"VRC4A": 1, "VRC4C": 2,
+	"VRC2B": 3, "VRC4E": 2, "VRC4F": 1,
+	"VRC2C": 3, "VRC4B": 1, "VRC4D": 2,
+	"VRC7A": 2, "VRC7B": 1,
+}
+
+var unifPrefixes = []string{"NES-", "HVC-", "UNL-", "BTL-", "BMC-", "KONAMI-", "SUNSOFT-", "NAMCOT-"}
+
+// UNIF is a cartridge in the Universal NES Image Format. Instead of a fixed
+// header it's a list of chunks, and the board is named rather than numbered.
+type UNIF struct {
+	name       string
+	board      string
+	mapper     int
+	submapper  int
+	programRom []*byte
+	charRom    []*byte
+	mirroring  Mirroring
+	battery    bool
+	timing     Timing
+}
+
+func (r *UNIF) Trainer() []*byte           { return []*byte{} }
+func (r *UNIF) Pages() int                 { return len(r.programRom) / programRomPageSize }
+func (r *UNIF) CharPages() int             { return len(r.charRom) / charRomPageSize }
+func (r *UNIF) ProgramRom() []*byte        { return r.programRom }
+func (r *UNIF) CharRom() []*byte           { return r.charRom }
+func (r *UNIF) PlayChoiceInstRom() []*byte { return []*byte{} }
+func (r *UNIF) PlayChoicePRom() []*byte    { return []*byte{} }
+func (r *UNIF) Mirroring() Mirroring       { return r.mirroring }
+func (r *UNIF) Mapper() int                { return r.mapper }
+func (r *UNIF) Submapper() int             { return r.submapper }
+func (r *UNIF) NES2() bool                 { return false }
+func (r *UNIF) CHRNVRAMSize() int          { return 0 }
+func (r *UNIF) Timing() Timing             { return r.timing }
+func (r *UNIF) Console() Console           { return ConsoleNES }
+func (r *UNIF) ExpansionDevice() int       { return 0 }
+
+// Name is the game's name from the NAME chunk, if there was one
+func (r *UNIF) Name() string { return r.name }
+
+// Board is the board name from the MAPR chunk
+func (r *UNIF) Board() string { return r.board }
+
+func (r *UNIF) PRGRAMSize() int {
+	if r.battery {
+		return 0
+	}
+	return defaultRAMSize
+}
+
+func (r *UNIF) PRGNVRAMSize() int {
+	if r.battery {
+		return defaultRAMSize
+	}
+	return 0
+}
+
+func (r *UNIF) CHRRAMSize() int {
+	if len(r.charRom) == 0 {
+		return defaultRAMSize
+	}
+	return 0
+}
+
+func pointers(b []byte) []*byte {
+	p := make([]*byte, len(b))
+	for i := range b {
+		p[i] = &b[i]
+	}
+	return p
+}
+
+// cString returns a null terminated string from a chunk
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+func NewUNIF(reader io.Reader) (ROM, error) {
+	raw, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return &UNIF{}, errors.New("Unable to read UNIF format from stream")
+	}
+
+	if len(raw) < unifHeaderSize || string(raw[0:4]) != "UNIF" {
+		return &UNIF{}, errors.New("Not a valid UNIF format")
+	}
+
+	var prg, chr [16][]byte
+	var prgCRC, chrCRC [16]*uint32
+	r := &UNIF{}
+
+	for data := raw[unifHeaderSize:]; len(data) > 0; {
+		if len(data) < 8 {
+			return r, errors.New("Truncated UNIF chunk header")
+		}
+
+		id := string(data[0:4])
+		size := binary.LittleEndian.Uint32(data[4:8])
+		if uint32(len(data)-8) < size {
+			return r, fmt.Errorf("Truncated UNIF %v chunk", id)
+		}
+		chunk := data[8 : 8+size]
+		data = data[8+size:]
+
+		// PRGn, CHRn, PCKn and CCKn are numbered with a hex digit
+		var n uint64
+		fmt.Sscanf(id[3:], "%X", &n)
+
+		switch {
+		case id == "MAPR":
+			r.board = cString(chunk)
+		case id == "NAME":
+			r.name = cString(chunk)
+		case id == "MIRR" && len(chunk) > 0:
+			// 5 means the mapper controls mirroring, which it will anyway
+			if chunk[0] <= byte(MirrorFourScreen) {
+				r.mirroring = []Mirroring{MirrorHorizontal, MirrorVertical, MirrorSingleA, MirrorSingleB, MirrorFourScreen}[chunk[0]]
+			}
+		case id == "BATR":
+			r.battery = len(chunk) == 0 || chunk[0] != 0
+		case id == "TVCI" && len(chunk) > 0:
+			switch chunk[0] {
+			case 1:
+				r.timing = TimingPAL
+			case 2:
+				r.timing = TimingMultiRegion
+			}
+		case strings.HasPrefix(id, "PRG"):
+			prg[n] = chunk
+		case strings.HasPrefix(id, "CHR"):
+			chr[n] = chunk
+		case strings.HasPrefix(id, "PCK") && len(chunk) >= 4:
+			crc := binary.LittleEndian.Uint32(chunk)
+			prgCRC[n] = &crc
+		case strings.HasPrefix(id, "CCK") && len(chunk) >= 4:
+			crc := binary.LittleEndian.Uint32(chunk)
+			chrCRC[n] = &crc
+		}
+	}
+
+	var prgData, chrData []byte
+	for i := range prg {
+		if prgCRC[i] != nil && prg[i] != nil && crc32.ChecksumIEEE(prg[i]) != *prgCRC[i] {
+			return r, fmt.Errorf("PRG%X chunk doesn't match its CRC", i)
+		}
+		if chrCRC[i] != nil && chr[i] != nil && crc32.ChecksumIEEE(chr[i]) != *chrCRC[i] {
+			return r, fmt.Errorf("CHR%X chunk doesn't match its CRC", i)
+		}
+		prgData = append(prgData, prg[i]...)
+		chrData = append(chrData, chr[i]...)
+	}
+
+	if len(prgData) == 0 {
+		return r, errors.New("UNIF file has no PRG chunks")
+	}
+	r.programRom = pointers(prgData)
+	r.charRom = pointers(chrData)
+
+	board := strings.ToUpper(r.board)
+	for _, prefix := range unifPrefixes {
+		board = strings.TrimPrefix(board, prefix)
+	}
+	mapper, ok := unifBoards[board]
+	if !ok {
+		return r, fmt.Errorf("Unsupported UNIF board %v", r.board)
+	}
+	r.mapper = mapper
+	r.submapper = unifSubmappers[board]
+
+	return r, nil
+}
@@ -0,0 +1,106 @@
+package rom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+)
+
+type unifChunk struct {
+	id   string
+	data []byte
+}
+
+func unifImage(chunks ...unifChunk) []byte {
+	image := make([]byte, unifHeaderSize)
+	copy(image, "UNIF")
+	image[4] = 7
+
+	for _, c := range chunks {
+		header := make([]byte, 8)
+		copy(header, c.id)
+		binary.LittleEndian.PutUint32(header[4:], uint32(len(c.data)))
+		image = append(image, header...)
+		image = append(image, c.data...)
+	}
+	return image
+}
+
+func checksum(data []byte) []byte {
+	crc := make([]byte, 4)
+	binary.LittleEndian.PutUint32(crc, crc32.ChecksumIEEE(data))
+	return crc
+}
+
+func TestUNIFChecksums(t *testing.T) {
+	prg := bytes.Repeat([]byte{0x11}, 0x8000)
+	chr := bytes.Repeat([]byte{0x22}, 0x2000)
+	bad := []byte{0, 0, 0, 0}
+
+	tests := []struct {
+		name     string
+		pck, cck []byte
+		ok       bool
+	}{
+		{"matching", checksum(prg), checksum(chr), true},
+		{"bad PRG", bad, checksum(chr), false},
+		{"bad CHR", checksum(prg), bad, false},
+	}
+
+	for _, test := range tests {
+		image := unifImage(
+			unifChunk{"MAPR", []byte("NES-NROM-256\x00")},
+			unifChunk{"PRG0", prg},
+			unifChunk{"PCK0", test.pck},
+			unifChunk{"CHR0", chr},
+			unifChunk{"CCK0", test.cck},
+		)
+
+		r, err := NewUNIF(bytes.NewReader(image))
+		if test.ok != (err == nil) {
+			t.Errorf("%v: error %v", test.name, err)
+			continue
+		}
+		if test.ok && (r.Pages() != 2 || r.CharPages() != 1) {
+			t.Errorf("%v: %v PRG pages and %v CHR pages, want 2 and 1", test.name, r.Pages(), r.CharPages())
+		}
+	}
+}
+
+func TestUNIFBoards(t *testing.T) {
+	tests := []struct {
+		board             string
+		mapper, submapper int
+	}{
+		{"NES-SLROM", 1, 0},
+		{"UNL-VRC7", 85, 0},
+		{"KONAMI-VRC4B", 25, 1},
+		{"KONAMI-VRC2B", 23, 3},
+		{"KONAMI-VRC6B", 26, 0},
+		{"NES-JLROM", 69, 0},
+		{"SUNSOFT-FME-7", 69, 0},
+		{"NAMCOT-163", 19, 0},
+	}
+
+	for _, test := range tests {
+		image := unifImage(
+			unifChunk{"MAPR", []byte(test.board)},
+			unifChunk{"PRG0", make([]byte, 0x4000)},
+		)
+
+		r, err := NewUNIF(bytes.NewReader(image))
+		if err != nil {
+			t.Errorf("%v: %v", test.board, err)
+			continue
+		}
+		if r.Mapper() != test.mapper || r.Submapper() != test.submapper {
+			t.Errorf("%v is mapper %v.%v, want %v.%v", test.board, r.Mapper(), r.Submapper(), test.mapper, test.submapper)
+		}
+	}
+
+	image := unifImage(unifChunk{"MAPR", []byte("IREM-G101")}, unifChunk{"PRG0", make([]byte, 0x4000)})
+	if _, err := NewUNIF(bytes.NewReader(image)); err == nil {
+		t.Errorf("Unsupported board loaded without an error")
+	}
+}